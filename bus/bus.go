@@ -0,0 +1,98 @@
+// Package bus implements engine.InvalidationBus, so that keys invalidated on
+// one fury instance are invalidated on all of them:
+//
+//	p, err := bus.Listen(":7946", "node2:7946", "node3:7946")
+//	e, err := engine.NewEngine(&engine.Options{..., InvalidationBus: p})
+//
+// Local connects engines of the same process, mostly for tests.
+package bus
+
+import (
+	"sync"
+
+	"github.com/wv0m56/fury/engine"
+)
+
+// Local is an in-process bus. Invalidations are applied synchronously, before
+// Publish returns.
+type Local struct {
+	mu        sync.Mutex
+	endpoints map[*endpoint]struct{}
+}
+
+func NewLocal() *Local {
+	return &Local{endpoints: make(map[*endpoint]struct{})}
+}
+
+// Join returns a new endpoint of the bus.
+func (l *Local) Join() engine.InvalidationBus {
+	ep := &endpoint{l: l}
+
+	l.mu.Lock()
+	l.endpoints[ep] = struct{}{}
+	l.mu.Unlock()
+
+	return ep
+}
+
+type endpoint struct {
+	l    *Local
+	subs subscribers
+}
+
+func (ep *endpoint) Publish(inv engine.Invalidation) {
+	ep.l.mu.Lock()
+	others := make([]*endpoint, 0, len(ep.l.endpoints))
+	for other := range ep.l.endpoints {
+		if other != ep {
+			others = append(others, other)
+		}
+	}
+	ep.l.mu.Unlock()
+
+	for _, other := range others {
+		other.subs.apply(inv)
+	}
+}
+
+func (ep *endpoint) Subscribe(apply func(engine.Invalidation)) func() {
+	return ep.subs.add(apply)
+}
+
+// subscribers are the callbacks passed to Subscribe.
+type subscribers struct {
+	mu   sync.Mutex
+	m    map[int]func(engine.Invalidation)
+	next int
+}
+
+func (s *subscribers) add(apply func(engine.Invalidation)) (remove func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.m == nil {
+		s.m = make(map[int]func(engine.Invalidation))
+	}
+	id := s.next
+	s.next++
+	s.m[id] = apply
+
+	return func() {
+		s.mu.Lock()
+		delete(s.m, id)
+		s.mu.Unlock()
+	}
+}
+
+func (s *subscribers) apply(inv engine.Invalidation) {
+	s.mu.Lock()
+	fs := make([]func(engine.Invalidation), 0, len(s.m))
+	for _, f := range s.m {
+		fs = append(fs, f)
+	}
+	s.mu.Unlock()
+
+	for _, f := range fs {
+		f(inv)
+	}
+}
@@ -0,0 +1,122 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/engine"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func newEngine(t *testing.T, b engine.InvalidationBus) *engine.Engine {
+	e, err := engine.NewEngine(&engine.Options{
+		ExpectedLen:                1024,
+		AccessStatsRelevanceWindow: time.Hour,
+		AccessStatsTickStep:        time.Second,
+		TTLTickStep:                time.Second,
+		CacheFillTimeout:           time.Second,
+		O:                          &testdummies.NoDelayOrigin{},
+		MaxPayloadTotalBytes:       10 * 1000 * 1000,
+		InvalidationBus:            b,
+	})
+	assert.Nil(t, err)
+	return e
+}
+
+func fill(e *engine.Engine, keys ...string) {
+	for _, k := range keys {
+		e.Get(k)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	l := NewLocal()
+	a, b, c := newEngine(t, l.Join()), newEngine(t, l.Join()), newEngine(t, nil)
+	defer a.Close(context.Background())
+	defer c.Close(context.Background())
+
+	for _, e := range []*engine.Engine{a, b, c} {
+		fill(e, "k1", "k2", "p/1", "p/2", "x")
+	}
+
+	a.Invalidate("k1", "k2")
+	assert.Equal(t, 3, a.Stats().Keys)
+	assert.Equal(t, 3, b.Stats().Keys)
+	assert.Equal(t, uint64(2), b.Stats().Invalidations)
+	assert.Equal(t, 5, c.Stats().Keys)
+
+	b.InvalidatePrefix("p/")
+	assert.Equal(t, 1, a.Stats().Keys)
+	assert.Equal(t, 1, b.Stats().Keys)
+
+	// b stops listening once closed
+	b.Close(context.Background())
+	a.Invalidate("x")
+	assert.Equal(t, 0, a.Stats().Keys)
+}
+
+func TestPeer(t *testing.T) {
+	p1, err := Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer p1.Close()
+	p2, err := Listen("127.0.0.1:0", p1.Addr().String())
+	assert.Nil(t, err)
+	defer p2.Close()
+	p1.SetPeers(p2.Addr().String())
+
+	e1, e2 := newEngine(t, p1), newEngine(t, p2)
+	defer e1.Close(context.Background())
+	defer e2.Close(context.Background())
+
+	fill(e1, "a", "b", "c")
+	fill(e2, "a", "b", "c")
+
+	keys := func(e *engine.Engine, n int) func() bool {
+		return func() bool { return e.Stats().Keys == n }
+	}
+
+	e1.Invalidate("a")
+	assert.Eventually(t, keys(e2, 2), time.Second, time.Millisecond)
+	e2.Invalidate("b")
+	assert.Eventually(t, keys(e1, 1), time.Second, time.Millisecond)
+
+	// removed peers are no longer sent to
+	p1.SetPeers()
+	e1.Invalidate("c")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, e2.Stats().Keys)
+	assert.Equal(t, uint64(0), p1.Dropped())
+
+	assert.Nil(t, p2.Close())
+	assert.Nil(t, p2.Close())
+}
+
+func TestPeerReconnects(t *testing.T) {
+	p1, err := Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer p1.Close()
+
+	p2, err := Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := p2.Addr().String()
+	p2.Close()
+
+	// p2 is down: the invalidation waits in the queue for it to come back
+	p1.SetPeers(addr)
+	p1.Publish(engine.Invalidation{Keys: []string{"a"}})
+
+	p2, err = Listen(addr)
+	assert.Nil(t, err)
+	defer p2.Close()
+	got := make(chan engine.Invalidation, 1)
+	p2.Subscribe(func(inv engine.Invalidation) { got <- inv })
+
+	select {
+	case inv := <-got:
+		assert.Equal(t, []string{"a"}, inv.Keys)
+	case <-time.After(3 * retryDelay):
+		t.Fatal("not delivered")
+	}
+}
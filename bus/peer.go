@@ -0,0 +1,252 @@
+package bus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wv0m56/fury/engine"
+)
+
+const (
+	// QueueLen is the number of invalidations queued for a peer which can't
+	// keep up or can't be reached. Further ones are dropped.
+	QueueLen = 1024
+
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	retryDelay   = 1 * time.Second
+)
+
+// Peer is the endpoint of a process on a bus of processes connected over TCP.
+// It listens for the invalidations of the other peers and sends its own to
+// them over long-lived connections, one JSON object per line, reconnecting
+// as needed. There's no discovery, every Peer is told the addresses of the
+// others. Delivery is best effort: invalidations sent while a peer restarts,
+// or dropped from a full queue, are lost.
+type Peer struct {
+	ln   net.Listener
+	subs subscribers
+
+	mu       sync.Mutex
+	remotes  map[string]*remote
+	incoming map[net.Conn]struct{}
+	closed   bool
+
+	wg      sync.WaitGroup
+	dropped uint64 // atomically
+}
+
+// Listen returns a Peer listening on addr and sending to the peers at addrs.
+func Listen(addr string, addrs ...string) (*Peer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Peer{
+		ln:       ln,
+		remotes:  make(map[string]*remote),
+		incoming: make(map[net.Conn]struct{}),
+	}
+	p.SetPeers(addrs...)
+
+	p.wg.Add(1)
+	go p.accept()
+
+	return p, nil
+}
+
+// Addr returns the address p listens on.
+func (p *Peer) Addr() net.Addr {
+	return p.ln.Addr()
+}
+
+// SetPeers replaces the addresses invalidations are sent to. addrs should not
+// include p itself, which would apply its own invalidations a second time.
+func (p *Peer) SetPeers(addrs ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+		if _, ok := p.remotes[addr]; ok {
+			continue
+		}
+
+		r := &remote{
+			addr:  addr,
+			queue: make(chan engine.Invalidation, QueueLen),
+		}
+		r.ctx, r.stop = context.WithCancel(context.Background())
+		p.remotes[addr] = r
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			r.run()
+		}()
+	}
+
+	for addr, r := range p.remotes {
+		if !keep[addr] {
+			r.stop()
+			delete(p.remotes, addr)
+		}
+	}
+}
+
+// Publish queues inv for every peer.
+func (p *Peer) Publish(inv engine.Invalidation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.remotes {
+		select {
+		case r.queue <- inv:
+		default:
+			atomic.AddUint64(&p.dropped, 1)
+		}
+	}
+}
+
+func (p *Peer) Subscribe(apply func(engine.Invalidation)) func() {
+	return p.subs.add(apply)
+}
+
+// Dropped returns the number of invalidations not sent to a peer because its
+// queue was full.
+func (p *Peer) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close stops listening and disconnects from all peers. Queued invalidations
+// not yet sent are lost.
+func (p *Peer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for addr, r := range p.remotes {
+		r.stop()
+		delete(p.remotes, addr)
+	}
+	for conn := range p.incoming {
+		conn.Close()
+	}
+	p.mu.Unlock()
+
+	err := p.ln.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *Peer) accept() {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return // closed
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return
+		}
+		p.incoming[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		go p.receive(conn)
+	}
+}
+
+func (p *Peer) receive(conn net.Conn) {
+	defer p.wg.Done()
+	defer func() {
+		p.mu.Lock()
+		delete(p.incoming, conn)
+		p.mu.Unlock()
+		conn.Close()
+	}()
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var inv engine.Invalidation
+		if err := dec.Decode(&inv); err != nil {
+			return
+		}
+		p.subs.apply(inv)
+	}
+}
+
+// remote sends the invalidations queued for a peer.
+type remote struct {
+	addr  string
+	queue chan engine.Invalidation
+	ctx   context.Context
+	stop  context.CancelFunc
+	conn  net.Conn
+}
+
+func (r *remote) run() {
+	defer func() {
+		if r.conn != nil {
+			r.conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case inv := <-r.queue:
+			if !r.send(inv) {
+				return
+			}
+		}
+	}
+}
+
+// send retries until inv is sent, returning false if stopped first.
+func (r *remote) send(inv engine.Invalidation) bool {
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return true // can't happen, nothing to retry anyway
+	}
+	b = append(b, '\n')
+
+	d := net.Dialer{Timeout: dialTimeout}
+	for {
+		if r.conn == nil {
+			r.conn, err = d.DialContext(r.ctx, "tcp", r.addr)
+		}
+		if err == nil {
+			r.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err = r.conn.Write(b); err == nil {
+				return true
+			}
+			r.conn.Close()
+			r.conn = nil
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return false
+		case <-time.After(retryDelay):
+		}
+	}
+}
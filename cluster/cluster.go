@@ -0,0 +1,311 @@
+// Package cluster spreads the keys of an origin over a group of fury
+// instances (peers), groupcache-style, so that every key is fetched from the
+// origin by a single peer only, its owner on a consistent hash ring.
+//
+// A Cluster is the origin of the engine of every peer. The cache fills of
+// keys owned by the peer itself go to the actual origin, those of other keys
+// to their owner over HTTP, which serves them from its own engine. Values
+// fetched from other peers are returned to the waiting callers without being
+// cached, unless they're hot, see Options.MirrorTTL.
+//
+//	c := cluster.New("http://10.0.0.1:8080/_peer", o, nil)
+//	c.SetPeers("http://10.0.0.1:8080/_peer", "http://10.0.0.2:8080/_peer")
+//	e, err := engine.NewEngine(&engine.Options{..., O: c})
+//	http.Handle("/_peer/", http.StripPrefix("/_peer", c.Handler(e)))
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	boom "github.com/tylertreat/BoomFilters"
+	"github.com/wv0m56/fury/engine"
+)
+
+// TTLHeader carries the TTL in seconds of values served to peers, if any.
+const TTLHeader = "Fury-Ttl"
+
+// hotSampleSize is the number of fetches from other peers after which hot
+// key counts are reset, so that keys no longer hot stop being mirrored.
+const hotSampleSize = 100 * 1000
+
+// Options configure a Cluster. The zero value is usable.
+type Options struct {
+	// VirtualNodes is the number of points of every peer on the hash ring,
+	// 100 if zero.
+	VirtualNodes int
+
+	// MirrorTTL, if not zero, has keys fetched from other peers at least
+	// HotThreshold times (10 if zero) cached locally too, for at most
+	// MirrorTTL. Mirrored copies are not invalidated along with the owner's,
+	// unless the peers share an engine.InvalidationBus.
+	MirrorTTL    time.Duration
+	HotThreshold int
+
+	// Client sends requests to other peers, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Cluster implements engine.Origin and engine.ContextOrigin. Peers are
+// identified by the base URL of their Handler.
+type Cluster struct {
+	self   string
+	o      engine.Origin
+	vnodes int
+	client *http.Client
+
+	mu   sync.RWMutex
+	ring *Ring
+
+	mirrorTTL    time.Duration
+	hotThreshold uint64
+	hotMu        sync.Mutex
+	hot          *boom.CountMinSketch
+	fetched      uint64
+}
+
+// New returns the Cluster of the peer at self, fetching the keys it owns from
+// o. It owns all keys until SetPeers is called.
+func New(self string, o engine.Origin, opts *Options) *Cluster {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	c := &Cluster{
+		self:         self,
+		o:            o,
+		vnodes:       opts.VirtualNodes,
+		client:       opts.Client,
+		ring:         NewRing(0),
+		mirrorTTL:    opts.MirrorTTL,
+		hotThreshold: uint64(opts.HotThreshold),
+		hot:          boom.NewCountMinSketch(0.001, 0.99),
+	}
+	if c.vnodes == 0 {
+		c.vnodes = 100
+	}
+	if c.client == nil {
+		c.client = http.DefaultClient
+	}
+	if c.hotThreshold == 0 {
+		c.hotThreshold = 10
+	}
+	return c
+}
+
+// SetPeers replaces the peers keys are spread over, which should include
+// self.
+func (c *Cluster) SetPeers(peers ...string) {
+	ring := NewRing(c.vnodes, peers...)
+
+	c.mu.Lock()
+	c.ring = ring
+	c.mu.Unlock()
+}
+
+// Owner returns the peer owning key, self if there are no peers.
+func (c *Cluster) Owner(key string) string {
+	c.mu.RLock()
+	owner := c.ring.Owner(key)
+	c.mu.RUnlock()
+
+	if owner == "" {
+		return c.self
+	}
+	return owner
+}
+
+func (c *Cluster) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return engine.FromContextOrigin(c).Fetch(key, timeout)
+}
+
+// FetchContext fetches key from the origin if self owns it or if asked by
+// another peer, from its owner otherwise. Should the owner be unreachable,
+// key is fetched from the origin after all.
+func (c *Cluster) FetchContext(ctx context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	owner := c.Owner(key)
+	if owner == c.self || forwarded(ctx) {
+		return c.fetchOrigin(ctx, key)
+	}
+
+	rc, exp, err := c.fetchPeer(ctx, owner, key)
+	var perr *peerError
+	if err != nil && !errors.As(err, &perr) && ctx.Err() == nil {
+		return c.fetchOrigin(ctx, key)
+	}
+	return rc, exp, err
+}
+
+func (c *Cluster) fetchOrigin(ctx context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	if co, ok := c.o.(engine.ContextOrigin); ok {
+		return co.FetchContext(ctx, key)
+	}
+
+	timeout := 10 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return c.o.Fetch(key, timeout)
+}
+
+// peerError is an error answered by a peer, as opposed to failing to reach it.
+type peerError struct {
+	peer   string
+	status int
+	msg    string
+}
+
+func (pe *peerError) Error() string {
+	return fmt.Sprintf("peer %s: %d %s", pe.peer, pe.status, pe.msg)
+}
+
+func (pe *peerError) Unwrap() error {
+	if pe.status == http.StatusNotFound {
+		return engine.ErrNotFound
+	}
+	return nil
+}
+
+func (c *Cluster) fetchPeer(ctx context.Context, peer, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	req, err := http.NewRequest(http.MethodGet,
+		peer+"/"+(&url.URL{Path: key}).EscapedPath(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, nil, &peerError{peer, resp.StatusCode,
+			strings.TrimSpace(string(msg))}
+	}
+
+	now := time.Now()
+	exp := &now // not cached by the engine
+	if c.mirrorTTL > 0 && c.isHot(key) {
+		mirrorExp := now.Add(c.mirrorTTL)
+		exp = &mirrorExp
+		if ttl, err := strconv.ParseFloat(resp.Header.Get(TTLHeader), 64); err == nil {
+			if ownerExp := now.Add(time.Duration(ttl * float64(time.Second))); ownerExp.Before(mirrorExp) {
+				exp = &ownerExp
+			}
+		}
+	}
+	return resp.Body, exp, nil
+}
+
+// isHot counts a fetch of key from another peer and reports whether key has
+// been fetched often enough to be mirrored.
+func (c *Cluster) isHot(key string) bool {
+	c.hotMu.Lock()
+	defer c.hotMu.Unlock()
+
+	c.hot.Add([]byte(key))
+	hot := c.hot.Count([]byte(key)) >= c.hotThreshold
+
+	if c.fetched++; c.fetched >= hotSampleSize {
+		c.hot.Reset()
+		c.fetched = 0
+	}
+	return hot
+}
+
+type forwardedKey struct{}
+
+func forwarded(ctx context.Context) bool {
+	f, _ := ctx.Value(forwardedKey{}).(bool)
+	return f
+}
+
+// Getter is implemented by engine.Engine and engine.ShardedEngine.
+type Getter interface {
+	GetContext(ctx context.Context, key string) (*bytes.Reader, error)
+	GetTTL(keys ...string) []float64
+}
+
+// Handler serves GET /{key} from e to the other peers, and must be reachable
+// at the URL self passed into New. The cache fills it triggers fetch from the
+// origin, even if the peers disagree on the owner of the key, e.g. while
+// their peer lists are being updated. Keys self doesn't own are fetched from
+// the origin without going through e, whose fill of the key may well be
+// waiting on the peer asking for it.
+func (c *Cluster) Handler(e Getter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if c.Owner(key) != c.self {
+			c.serveOrigin(w, r, key)
+			return
+		}
+
+		br, err := e.GetContext(context.WithValue(r.Context(), forwardedKey{}, true), key)
+		if err != nil {
+			http.Error(w, err.Error(), statusOf(err))
+			return
+		}
+
+		if ttl := e.GetTTL(key)[0]; ttl != -1 {
+			w.Header().Set(TTLHeader, strconv.FormatFloat(ttl, 'f', -1, 64))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(br.Len()))
+		io.Copy(w, br)
+	})
+}
+
+// serveOrigin serves key to another peer straight from the origin.
+func (c *Cluster) serveOrigin(w http.ResponseWriter, r *http.Request, key string) {
+	rc, exp, err := c.fetchOrigin(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if exp != nil {
+		ttl := time.Until(*exp).Seconds()
+		w.Header().Set(TTLHeader, strconv.FormatFloat(ttl, 'f', -1, 64))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Write(b)
+}
+
+func statusOf(err error) int {
+	if errors.Is(err, engine.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,204 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/engine"
+)
+
+// countingOrigin counts the fetches of every key. Keys prefixed by "404"
+// don't exist.
+type countingOrigin struct {
+	sync.Mutex
+	fetches map[string]int
+}
+
+func (co *countingOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	co.Lock()
+	co.fetches[key]++
+	co.Unlock()
+
+	if len(key) >= 3 && key[:3] == "404" {
+		return nil, nil, fmt.Errorf("%s: %w", key, engine.ErrNotFound)
+	}
+	exp := time.Now().Add(time.Hour)
+	return ioutil.NopCloser(bytes.NewReader([]byte("value of " + key))), &exp, nil
+}
+
+type peer struct {
+	c   *Cluster
+	e   *engine.Engine
+	srv *httptest.Server
+}
+
+func newPeers(t *testing.T, o engine.Origin, n int, opts *Options) []*peer {
+	peers := make([]*peer, n)
+	urls := make([]string, n)
+	for i := range peers {
+		p := &peer{}
+		mux := http.NewServeMux()
+		p.srv = httptest.NewServer(mux)
+		urls[i] = p.srv.URL + "/_peer"
+
+		p.c = New(urls[i], o, opts)
+		var err error
+		p.e, err = engine.NewEngine(&engine.Options{
+			ExpectedLen:                1024,
+			AccessStatsRelevanceWindow: time.Hour,
+			AccessStatsTickStep:        time.Second,
+			TTLTickStep:                time.Second,
+			CacheFillTimeout:           time.Second,
+			O:                          p.c,
+			MaxPayloadTotalBytes:       10 * 1000 * 1000,
+			NegativeTTLNotFound:        time.Hour,
+		})
+		assert.Nil(t, err)
+		mux.Handle("/_peer/", http.StripPrefix("/_peer", p.c.Handler(p.e)))
+		peers[i] = p
+	}
+
+	for _, p := range peers {
+		p.c.SetPeers(urls...)
+	}
+	return peers
+}
+
+func closePeers(peers []*peer) {
+	for _, p := range peers {
+		p.srv.Close()
+		p.e.Close(context.Background())
+	}
+}
+
+func get(t *testing.T, e *engine.Engine, key string) string {
+	br, err := e.Get(key)
+	assert.Nil(t, err)
+	if err != nil {
+		return ""
+	}
+	b, _ := ioutil.ReadAll(br)
+	return string(b)
+}
+
+func TestCluster(t *testing.T) {
+	o := &countingOrigin{fetches: map[string]int{}}
+	peers := newPeers(t, o, 3, nil)
+	defer closePeers(peers)
+
+	owned := map[string]int{}
+	for i := 0; i < 30; i++ {
+		k := "k" + strconv.Itoa(i)
+		for _, p := range peers {
+			assert.Equal(t, "value of "+k, get(t, p.e, k))
+		}
+		owned[peers[0].c.Owner(k)]++
+	}
+	assert.Equal(t, 3, len(owned)) // every peer owns some keys
+
+	o.Lock()
+	for k, n := range o.fetches {
+		assert.Equal(t, 1, n, k)
+	}
+	assert.Equal(t, 30, len(o.fetches))
+	o.Unlock()
+
+	// only owners cache their keys
+	keys := 0
+	for _, p := range peers {
+		keys += p.e.Stats().Keys
+	}
+	assert.Equal(t, 30, keys)
+
+	for _, p := range peers {
+		_, err := p.e.Get("404")
+		assert.True(t, errors.Is(err, engine.ErrNotFound))
+	}
+	o.Lock()
+	assert.Equal(t, 1, o.fetches["404"])
+	o.Unlock()
+}
+
+func TestMirror(t *testing.T) {
+	o := &countingOrigin{fetches: map[string]int{}}
+	peers := newPeers(t, o, 2, &Options{MirrorTTL: time.Minute, HotThreshold: 3})
+	defer closePeers(peers)
+
+	key := "hot"
+	for i := 0; peers[0].c.Owner(key) == peers[0].c.self; i++ {
+		key = "hot" + strconv.Itoa(i)
+	}
+	nonOwner := peers[0]
+
+	for i := 0; i < 2; i++ {
+		get(t, nonOwner.e, key)
+		assert.Equal(t, 0, nonOwner.e.Stats().Keys)
+	}
+	get(t, nonOwner.e, key)
+	assert.Equal(t, 1, nonOwner.e.Stats().Keys)
+	ttl := nonOwner.e.GetTTL(key)[0]
+	assert.True(t, ttl > 50 && ttl <= 60)
+
+	get(t, nonOwner.e, key)
+	assert.Equal(t, uint64(1), nonOwner.e.Stats().Hits)
+}
+
+func TestUnreachableOwner(t *testing.T) {
+	o := &countingOrigin{fetches: map[string]int{}}
+	peers := newPeers(t, o, 2, nil)
+	defer closePeers(peers)
+
+	peers[1].srv.Close()
+	for i := 0; i < 10; i++ {
+		k := "k" + strconv.Itoa(i)
+		assert.Equal(t, "value of "+k, get(t, peers[0].e, k))
+	}
+
+	// back to owning all keys
+	peers[0].c.SetPeers(peers[0].c.self)
+	assert.Equal(t, peers[0].c.self, peers[0].c.Owner("k1"))
+	o.Lock()
+	assert.Equal(t, 10, len(o.fetches))
+	o.Unlock()
+}
+
+func TestDisagreeingPeers(t *testing.T) {
+	o := &countingOrigin{fetches: map[string]int{}}
+	peers := newPeers(t, o, 2, nil)
+	defer closePeers(peers)
+
+	// each thinks the other owns all keys
+	peers[0].c.SetPeers(peers[1].c.self)
+	peers[1].c.SetPeers(peers[0].c.self)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		k := "k" + strconv.Itoa(i)
+		for _, p := range peers {
+			wg.Add(1)
+			go func(p *peer) {
+				defer wg.Done()
+				assert.Equal(t, "value of "+k, get(t, p.e, k))
+			}(p)
+		}
+	}
+	wg.Wait()
+	assert.True(t, time.Since(start) < 500*time.Millisecond) // fill timeout is 1s
+
+	// not cached by either, both having asked the other
+	assert.Equal(t, 0, peers[0].e.Stats().Keys+peers[1].e.Stats().Keys)
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Ring assigns keys to peers by consistent hashing. Every peer is placed on
+// the ring at several points (virtual nodes), so that keys are spread evenly
+// and only about 1/n of them move when one of n peers joins or leaves.
+// A Ring is immutable.
+type Ring struct {
+	hashes []uint64 // sorted
+	peers  map[uint64]string
+}
+
+// NewRing returns a Ring placing every peer at vnodes points.
+func NewRing(vnodes int, peers ...string) *Ring {
+	r := &Ring{
+		hashes: make([]uint64, 0, vnodes*len(peers)),
+		peers:  make(map[uint64]string, vnodes*len(peers)),
+	}
+
+	for _, p := range peers {
+		for i := 0; i < vnodes; i++ {
+			h := hash(strconv.Itoa(i) + "#" + p)
+			if _, taken := r.peers[h]; taken {
+				continue
+			}
+			r.peers[h] = p
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+
+	return r
+}
+
+// Owner returns the peer owning key, the first one clockwise from the hash of
+// key, or "" if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.peers[r.hashes[i]]
+}
+
+// hash is FNV-1a, with its bits mixed further so that similar strings such as
+// the virtual nodes of a peer land far apart.
+func hash(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+
+	// splitmix64 finalizer
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
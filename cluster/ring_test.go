@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	assert.Equal(t, "", NewRing(100).Owner("a"))
+	assert.Equal(t, "p1", NewRing(100, "p1").Owner("a"))
+
+	peers := []string{"p1", "p2", "p3", "p4"}
+	r := NewRing(100, peers...)
+
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 10000; i++ {
+		k := strconv.Itoa(i)
+		owners[k] = r.Owner(k)
+		counts[owners[k]]++
+	}
+	for _, p := range peers {
+		assert.InDelta(t, 2500, counts[p], 750, p)
+	}
+
+	// only the keys of a leaving peer move
+	r = NewRing(100, "p1", "p2", "p3")
+	for k, owner := range owners {
+		if owner != "p4" {
+			assert.Equal(t, owner, r.Owner(k))
+		} else {
+			assert.NotEqual(t, "p4", r.Owner(k))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Command fury is a caching HTTP proxy: it serves GET /{key} from a cache
+// engine, filling it from an upstream HTTP server.
+//
+//	fury -upstream http://backend:8000/static -addr :8080 -admin-addr 127.0.0.1:8081
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wv0m56/fury/bus"
+	"github.com/wv0m56/fury/cluster"
+	"github.com/wv0m56/fury/engine"
+	"github.com/wv0m56/fury/httporigin"
+)
+
+func main() {
+	var (
+		addr      = flag.String("addr", ":8080", "address to listen on")
+		adminAddr = flag.String("admin-addr", "127.0.0.1:8081", "address to serve invalidations, TTLs, stats and metrics on")
+		upstream  = flag.String("upstream", "", "base URL of the upstream server (required)")
+
+		expectedLen = flag.Int64("expected-len", 1000*1000, "expected number of cached keys")
+		maxBytes    = flag.Int64("max-bytes", 1000*1000*1000, "maximum total size of cached values")
+		maxItem     = flag.Int64("max-item-bytes", 0, "maximum size of a cached value, 0 for max-bytes")
+		admission   = flag.Bool("admission", false, "only cache values more frequently requested than those they'd evict")
+		fillTimeout = flag.Duration("fill-timeout", 10*time.Second, "timeout of upstream requests")
+		defaultTTL  = flag.Duration("default-ttl", 0, "TTL of responses without caching headers, 0 for none")
+
+		swr         = flag.Duration("stale-while-revalidate", 0, "serve expired values while refreshing them for this long")
+		sie         = flag.Duration("stale-if-error", 0, "serve expired values on upstream errors for this long")
+		notFoundTTL = flag.Duration("not-found-ttl", 0, "how long to cache upstream 404s")
+
+		shards   = flag.Int("shards", 1, "number of independently locked cache shards")
+		snapshot = flag.String("snapshot", "", "file to save the cache to on shutdown and restore it from on startup")
+
+		busAddr  = flag.String("bus-addr", "", "address to receive invalidations of other instances on")
+		busPeers = flag.String("bus-peers", "", "comma separated -bus-addr of the other instances")
+
+		self   = flag.String("self", "", "URL other instances reach this one's -admin-addr at, e.g. http://10.0.0.1:8081, to share keys with -peers")
+		peers  = flag.String("peers", "", "comma separated -self of all instances sharing keys, this one included")
+		mirror = flag.Duration("mirror-ttl", 0, "cache keys owned by other instances locally for this long once hot, 0 for never")
+	)
+	flag.Parse()
+
+	if *upstream == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	o, err := httporigin.New(*upstream, &http.Client{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	o.DefaultTTL = *defaultTTL
+
+	var c *cluster.Cluster
+	if *self != "" {
+		c = cluster.New(peerURLs(*self)[0], o, &cluster.Options{MirrorTTL: *mirror})
+		if *peers != "" {
+			c.SetPeers(peerURLs(*peers)...)
+		}
+	}
+
+	opts := &engine.Options{
+		ExpectedLen:                *expectedLen,
+		AccessStatsRelevanceWindow: 1 * time.Hour,
+		AccessStatsTickStep:        1 * time.Second,
+		TTLTickStep:                100 * time.Millisecond,
+		CacheFillTimeout:           *fillTimeout,
+		O:                          origin(o, c),
+		MaxPayloadTotalBytes:       *maxBytes,
+		MaxItemBytes:               *maxItem,
+		Admission:                  *admission,
+		StaleWhileRevalidate:       *swr,
+		StaleIfError:               *sie,
+		NegativeTTLNotFound:        *notFoundTTL,
+	}
+
+	if *busAddr != "" {
+		var peers []string
+		if *busPeers != "" {
+			peers = strings.Split(*busPeers, ",")
+		}
+		p, err := bus.Listen(*busAddr, peers...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		opts.InvalidationBus = p
+	}
+
+	var e cache
+	if *shards > 1 {
+		e, err = engine.NewShardedEngine(opts, *shards)
+	} else {
+		e, err = engine.NewEngine(opts)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *snapshot != "" {
+		if n, err := restore(e, *snapshot); err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("restored %d keys from %s", n, *snapshot)
+		}
+	}
+
+	s := newServer(e)
+	if c != nil {
+		s.mountCluster(c)
+	}
+	srv := &http.Server{Addr: *addr, Handler: s}
+	admin := &http.Server{Addr: *adminAddr, Handler: s.admin}
+
+	shutdown := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(stopped)
+
+		<-shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), *fillTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+		if err := admin.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+		if *snapshot != "" {
+			if err := save(e, *snapshot); err != nil {
+				log.Println(err)
+			}
+		}
+		if err := e.Close(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	go func() {
+		if err := admin.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	log.Printf("fury listening on %s, admin on %s, upstream %s", *addr, *adminAddr, *upstream)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+}
+
+// origin returns c if there's one, o otherwise.
+func origin(o *httporigin.Origin, c *cluster.Cluster) engine.Origin {
+	if c != nil {
+		return c
+	}
+	return o
+}
+
+// restore fills e from the snapshot at path, if there's one.
+func restore(e cache, path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return e.Restore(f)
+}
+
+// save snapshots e to path, replacing any previous snapshot only once the new
+// one is complete.
+func save(e cache, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails harmlessly once renamed
+
+	if err := e.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
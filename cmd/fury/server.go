@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wv0m56/fury/cluster"
+	"github.com/wv0m56/fury/engine"
+	"github.com/wv0m56/fury/metrics"
+)
+
+const peerPath = "/peer"
+
+// server serves GET /{key} from the engine. The admin handler, meant for a
+// listener of its own out of the public's reach, serves
+//
+//	POST /invalidate?key=k1&key=k2&prefix=p&tag=t
+//	GET  /ttl?key=k1&key=k2
+//	GET  /stats
+//	GET  /metrics (Prometheus text format)
+//
+// and, when sharing keys with other instances (see mountCluster)
+//
+//	GET  /peer/{key} (for other instances)
+//	POST /peers?peer=http://10.0.0.1:8081&peer=http://10.0.0.2:8081
+type server struct {
+	e     cache
+	mux   *http.ServeMux
+	admin *http.ServeMux
+}
+
+// cache is implemented by both engine.Engine and engine.ShardedEngine.
+type cache interface {
+	GetContext(ctx context.Context, key string) (*bytes.Reader, error)
+	GetTTL(keys ...string) []float64
+	Invalidate(keys ...string)
+	InvalidatePrefix(prefix string) int
+	InvalidateTag(tag string) int
+	Stats() engine.Stats
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) (int, error)
+	Close(ctx context.Context) error
+}
+
+func newServer(e cache) *server {
+	s := &server{e, http.NewServeMux(), http.NewServeMux()}
+	s.mux.HandleFunc("/", s.get)
+	s.admin.HandleFunc("/invalidate", s.invalidate)
+	s.admin.HandleFunc("/ttl", s.ttl)
+	s.admin.HandleFunc("/stats", s.stats)
+	s.admin.Handle("/metrics", metrics.Handler(e))
+	return s
+}
+
+// mountCluster serves the keys of e owned by this instance to the other
+// instances of c, and lets their list be replaced at runtime, both on the
+// admin handler.
+func (s *server) mountCluster(c *cluster.Cluster) {
+	s.admin.Handle(peerPath+"/", http.StripPrefix(peerPath, c.Handler(s.e)))
+	s.admin.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		c.SetPeers(peerURLs(strings.Join(r.URL.Query()["peer"], ","))...)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// peerURLs maps the comma separated base URLs of the admin handlers of
+// instances onto the URLs of their peer handlers.
+func peerURLs(list string) []string {
+	var urls []string
+	for _, u := range strings.Split(list, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, strings.TrimSuffix(u, "/")+peerPath)
+		}
+	}
+	return urls
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *server) get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	br, err := s.e.GetContext(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+
+	if ttl := s.e.GetTTL(key)[0]; ttl > 0 {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(ttl)))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(br.Len()))
+	if r.Method == http.MethodGet {
+		io.Copy(w, br)
+	}
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, engine.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case err == engine.ErrClosed:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (s *server) invalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	s.e.Invalidate(q["key"]...)
+	for _, p := range q["prefix"] {
+		s.e.InvalidatePrefix(p)
+	}
+	for _, t := range q["tag"] {
+		s.e.InvalidateTag(t)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) ttl(w http.ResponseWriter, r *http.Request) {
+	keys := r.URL.Query()["key"]
+	secs := s.e.GetTTL(keys...)
+
+	ttls := make(map[string]float64, len(keys))
+	for i, k := range keys {
+		ttls[k] = secs[i]
+	}
+	writeJSON(w, ttls)
+}
+
+func (s *server) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.e.Stats())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/cluster"
+	"github.com/wv0m56/fury/engine"
+	"github.com/wv0m56/fury/httporigin"
+)
+
+func TestServer(t *testing.T) {
+	var fetches int32
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			if r.URL.Path == "/missing" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Cache-Control", "max-age=100")
+			w.Header().Set("Surrogate-Key", "all "+r.URL.Path)
+			w.Write([]byte("value of " + r.URL.Path))
+		}))
+	defer upstream.Close()
+
+	o, err := httporigin.New(upstream.URL, nil)
+	assert.Nil(t, err)
+	e, err := engine.NewEngine(&engine.Options{
+		ExpectedLen:                1024,
+		AccessStatsRelevanceWindow: time.Second,
+		AccessStatsTickStep:        time.Second,
+		TTLTickStep:                time.Second,
+		CacheFillTimeout:           time.Second,
+		O:                          o,
+		MaxPayloadTotalBytes:       10 * 1000 * 1000,
+	})
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	s := newServer(e)
+	fury := httptest.NewServer(s)
+	defer fury.Close()
+	admin := httptest.NewServer(s.admin)
+	defer admin.Close()
+
+	get := func(url string) (int, string, http.Header) {
+		resp, err := http.Get(url)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), resp.Header
+	}
+
+	for i := 0; i < 3; i++ {
+		code, body, h := get(fury.URL + "/a/b")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "value of /a/b", body)
+		assert.Equal(t, "max-age=99", h.Get("Cache-Control"))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	code, _, _ := get(fury.URL + "/missing")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// admin endpoints aren't served publicly
+	resp, err := http.Post(fury.URL+"/invalidate?prefix=", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, 1, e.Stats().Keys)
+
+	code, body, _ := get(admin.URL + "/ttl?key=a/b&key=x")
+	assert.Equal(t, http.StatusOK, code)
+	var ttls map[string]float64
+	assert.Nil(t, json.Unmarshal([]byte(body), &ttls))
+	assert.True(t, ttls["a/b"] > 99)
+	assert.Equal(t, -1.0, ttls["x"])
+
+	code, body, _ = get(admin.URL + "/stats")
+	assert.Equal(t, http.StatusOK, code)
+	var st engine.Stats
+	assert.Nil(t, json.Unmarshal([]byte(body), &st))
+	assert.Equal(t, 1, st.Keys)
+
+	code, body, _ = get(admin.URL + "/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "fury_keys 1\n")
+
+	code, _, _ = get(admin.URL + "/invalidate?key=a/b")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	resp, err = http.Post(admin.URL+"/invalidate?key=a/b", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, 0, e.Stats().Keys)
+
+	get(fury.URL + "/a/b")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+
+	get(fury.URL + "/a/c")
+	get(fury.URL + "/b")
+	resp, err = http.Post(admin.URL+"/invalidate?tag=/a/b&prefix=a/c", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, e.Stats().Keys)
+	resp, err = http.Post(admin.URL+"/invalidate?tag=all", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 0, e.Stats().Keys)
+}
+
+func TestServerCluster(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=100")
+			w.Write([]byte("value of " + r.URL.Path))
+		}))
+	defer upstream.Close()
+
+	o, err := httporigin.New(upstream.URL, nil)
+	assert.Nil(t, err)
+	c := cluster.New("http://self"+peerPath, o, nil)
+	e, err := engine.NewEngine(&engine.Options{
+		ExpectedLen:                1024,
+		AccessStatsRelevanceWindow: time.Second,
+		AccessStatsTickStep:        time.Second,
+		TTLTickStep:                time.Second,
+		CacheFillTimeout:           time.Second,
+		O:                          c,
+		MaxPayloadTotalBytes:       10 * 1000 * 1000,
+	})
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	s := newServer(e)
+	s.mountCluster(c)
+	fury := httptest.NewServer(s)
+	defer fury.Close()
+	admin := httptest.NewServer(s.admin)
+	defer admin.Close()
+
+	// peers can't be replaced publicly
+	resp, err := http.Post(fury.URL+"/peers?peer=http://evil", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "http://self"+peerPath, c.Owner("a"))
+
+	resp, err = http.Get(admin.URL + "/peer/a/b")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "value of /a/b", string(b))
+	assert.Equal(t, "99", resp.Header.Get(cluster.TTLHeader)[:2])
+
+	resp, err = http.Post(admin.URL+"/peers?peer=http://self&peer=http://other/", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	owners := map[string]bool{}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		owners[c.Owner(k)] = true
+	}
+	assert.Equal(t, map[string]bool{"http://self" + peerPath: true, "http://other" + peerPath: true}, owners)
+}
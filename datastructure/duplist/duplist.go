@@ -0,0 +1,223 @@
+package duplist
+
+import (
+	"math/rand"
+)
+
+// DupList is a modified skiplist implementation allowing duplicate keys to
+// exist inside the same list. Elements with duplicate keys are adjacent inside
+// DupList, with a later insert placed left of earlier ones.
+// Elements with different keys are sorted in ascending order of compare, which
+// returns a negative number, zero or a positive number when a is less than,
+// equal to or greater than b.
+// DupList does not allow random get or delete by specifying a key and
+// instead only allows get or delete on the first element of the list, or delete
+// by specifying an element pointer.
+type DupList[K, V any] struct {
+	front     []*Element[K, V]
+	back      *Element[K, V]
+	len       int
+	rhg       *randomHeightGenerator
+	maxHeight int
+	compare   func(a, b K) int
+}
+
+func New[K, V any](maxHeight int, compare func(a, b K) int) *DupList[K, V] {
+	return NewWithSource[K, V](maxHeight, compare, nil)
+}
+
+// NewWithSource is New with element heights drawn from src, such that lists
+// created with equally seeded sources and filled the same way are laid out
+// the same way. src is not safe for concurrent use by several lists.
+// A nil src means one seeded with the current time, as with New.
+func NewWithSource[K, V any](maxHeight int, compare func(a, b K) int,
+	src rand.Source) *DupList[K, V] {
+
+	dl := &DupList[K, V]{}
+	dl.init(maxHeight, compare, src)
+	return dl
+}
+
+func (dl *DupList[K, V]) Init(maxHeight int, compare func(a, b K) int) {
+	dl.init(maxHeight, compare, nil)
+}
+
+func (dl *DupList[K, V]) init(maxHeight int, compare func(a, b K) int, src rand.Source) {
+	dl.maxHeight = maxHeight
+	dl.front = make([]*Element[K, V], maxHeight)
+	if maxHeight < 2 || maxHeight >= 64 {
+		panic("maxHeight must be between 2 and 64")
+	}
+	if compare == nil {
+		panic("compare must not be nil")
+	}
+	dl.rhg = newRandomHeightGenerator(maxHeight, src)
+	dl.compare = compare
+}
+
+func (dl *DupList[K, V]) First() *Element[K, V] {
+	return dl.front[0]
+}
+
+func (dl *DupList[K, V]) Last() *Element[K, V] {
+	return dl.back
+}
+
+// Len returns the number of elements in the list.
+func (dl *DupList[K, V]) Len() int {
+	return dl.len
+}
+
+// Seek returns the first element whose key is greater than or equal to key,
+// or nil if there is none.
+func (dl *DupList[K, V]) Seek(key K) *Element[K, V] {
+	var left, right *Element[K, V]
+
+	for h := dl.maxHeight - 1; h >= 0; h-- {
+		if left == nil {
+			right = dl.front[h]
+		} else {
+			right = left.nexts[h]
+		}
+
+		for right != nil && dl.compare(key, right.key) > 0 {
+			left = right
+			right = right.nexts[h]
+		}
+	}
+
+	return right
+}
+
+// Range calls yield with the elements whose keys are within [lo, hi), in
+// order, until yield returns false.
+func (dl *DupList[K, V]) Range(lo, hi K, yield func(el *Element[K, V]) bool) {
+	for it := dl.Seek(lo); it != nil && dl.compare(it.key, hi) < 0; it = it.Next() {
+		if !yield(it) {
+			return
+		}
+	}
+}
+
+func (dl *DupList[K, V]) DelElement(el *Element[K, V]) {
+	if el == nil {
+		return
+	}
+
+	if el.nexts[0] == nil {
+		dl.back = el.prevs[0]
+	}
+	dl.len--
+
+	for i := 0; i < len(el.nexts); i++ {
+
+		if el.prevs[i] == nil {
+			dl.front[i] = el.nexts[i]
+		} else {
+			el.prevs[i].nexts[i] = el.nexts[i]
+		}
+
+		if el.nexts[i] != nil {
+			el.nexts[i].prevs[i] = el.prevs[i]
+		}
+	}
+}
+
+func (dl *DupList[K, V]) Insert(key K, val V) *Element[K, V] {
+
+	el := newElement(key, val, dl.rhg)
+
+	if dl.front[0] == nil {
+		dl.insert(make([]*Element[K, V], dl.maxHeight), el, nil)
+	} else {
+		dl.searchAndInsert(el)
+	}
+
+	if el.nexts[0] == nil {
+		dl.back = el
+	}
+	dl.len++
+	return el
+}
+
+func (dl *DupList[K, V]) searchAndInsert(el *Element[K, V]) {
+	leftAll, right := dl.search(el.key)
+	dl.insert(leftAll, el, right)
+}
+
+func (dl *DupList[K, V]) search(key K) (
+	leftAll []*Element[K, V],
+	right *Element[K, V], // iterator and result
+) {
+
+	leftAll = make([]*Element[K, V], dl.maxHeight)
+
+	for h := dl.maxHeight - 1; h >= 0; h-- {
+
+		if h == dl.maxHeight-1 || leftAll[h+1] == nil {
+			right = dl.front[h]
+		} else {
+			leftAll[h] = leftAll[h+1]
+			right = leftAll[h].nexts[h]
+		}
+
+		for {
+			if right == nil || dl.compare(key, right.key) <= 0 {
+				break
+			} else {
+				leftAll[h] = right
+				right = right.nexts[h]
+			}
+		}
+	}
+
+	return
+}
+
+func (dl *DupList[K, V]) insert(leftAll []*Element[K, V], el, right *Element[K, V]) {
+
+	for i := 0; i < len(el.nexts); i++ {
+		el.prevs[i] = leftAll[i]
+
+		if right != nil && i < len(el.nexts) {
+
+			if i < len(right.nexts) {
+				right.prevs[i] = el
+
+			} else {
+
+				if leftAll[i] != nil {
+					if leftAll[i].nexts[i] != nil {
+						leftAll[i].nexts[i].prevs[i] = el
+					}
+
+				} else {
+					if dl.front[i] != nil {
+						dl.front[i].prevs[i] = el
+					}
+				}
+			}
+		}
+
+		if right != nil && i < len(right.nexts) {
+
+			el.nexts[i] = right
+
+		} else {
+
+			// intercept leftAll[i].nexts[i]
+			if leftAll[i] != nil {
+				el.nexts[i] = leftAll[i].nexts[i]
+			} else {
+				el.nexts[i] = dl.front[i]
+			}
+		}
+
+		// reassign what leftAll[i].nexts[i] points to
+		if leftAll[i] == nil {
+			dl.front[i] = el
+		} else {
+			leftAll[i].nexts[i] = el
+		}
+	}
+}
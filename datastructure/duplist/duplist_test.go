@@ -0,0 +1,114 @@
+package duplist
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDupList(t *testing.T) {
+
+	// descending
+	d := New[string, int](8, func(a, b string) int { return -strings.Compare(a, b) })
+	assert.Nil(t, d.First())
+
+	one := d.Insert("b", 1)
+	d.Insert("b", 2)
+	d.Insert("c", 3)
+	d.Insert("a", 4)
+	d.Insert("b", 5)
+
+	var keys string
+	var vals []int
+	for it := d.First(); it != nil; it = it.Next() {
+		keys += it.Key()
+		vals = append(vals, it.Val())
+	}
+	assert.Equal(t, "cbbba", keys)
+	assert.Equal(t, []int{3, 5, 2, 1, 4}, vals)
+
+	d.DelElement(one)
+	d.DelElement(d.First())
+	vals = nil
+	for it := d.First(); it != nil; it = it.Next() {
+		vals = append(vals, it.Val())
+	}
+	assert.Equal(t, []int{5, 2, 4}, vals)
+}
+
+func TestDupListNavigation(t *testing.T) {
+
+	d := NewUint64String(8)
+	assert.Equal(t, 0, d.Len())
+	assert.Nil(t, d.Last())
+	assert.Nil(t, d.Seek(0))
+	d.Range(0, 100, func(*Uint64StringElement) bool {
+		t.Fatal("empty list")
+		return false
+	})
+
+	els := map[string]*Uint64StringElement{}
+	for i, v := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		els[v] = d.Insert(uint64(i/2*10), v) // 0 0 10 10 20 20 ...
+	}
+	assert.Equal(t, 10, d.Len())
+
+	var vals string
+	for it := d.Last(); it != nil; it = it.Prev() {
+		vals += it.Val()
+	}
+	assert.Equal(t, "ijghefcdab", vals)
+
+	assert.Equal(t, "d", d.Seek(10).Val())
+	assert.Equal(t, "f", d.Seek(11).Val())
+	assert.Equal(t, "b", d.Seek(0).Val())
+	assert.Nil(t, d.Seek(41))
+
+	vals = ""
+	d.Range(5, 30, func(el *Uint64StringElement) bool {
+		vals += el.Val()
+		return true
+	})
+	assert.Equal(t, "dcfe", vals)
+
+	vals = ""
+	d.Range(0, 100, func(el *Uint64StringElement) bool {
+		vals += el.Val()
+		return len(vals) < 3
+	})
+	assert.Equal(t, "bad", vals)
+
+	d.DelElement(els["i"])
+	assert.Equal(t, "j", d.Last().Val())
+	d.DelElement(els["j"])
+	assert.Equal(t, "g", d.Last().Val())
+	assert.Equal(t, 8, d.Len())
+
+	for it := d.First(); it != nil; it = d.First() {
+		d.DelElement(it)
+	}
+	assert.Equal(t, 0, d.Len())
+	assert.Nil(t, d.Last())
+	assert.Nil(t, d.First())
+}
+
+func TestDupListWithSource(t *testing.T) {
+
+	heights := func(seed int64) []int {
+		d := NewUint64StringWithSource(24, rand.NewSource(seed))
+		for i := 0; i < 100; i++ {
+			d.Insert(uint64(i%7), "")
+		}
+
+		var hs []int
+		for it := d.First(); it != nil; it = it.Next() {
+			hs = append(hs, len(it.nexts))
+		}
+		return hs
+	}
+
+	assert.Equal(t, heights(1), heights(1))
+	assert.NotEqual(t, heights(1), heights(2))
+}
@@ -0,0 +1,33 @@
+package duplist
+
+type Element[K, V any] struct {
+	key   K
+	val   V
+	prevs []*Element[K, V]
+	nexts []*Element[K, V]
+}
+
+func (el *Element[K, V]) Key() K {
+	return el.key
+}
+
+func (el *Element[K, V]) Val() V {
+	return el.val
+}
+
+func (el *Element[K, V]) Next() *Element[K, V] {
+	return el.nexts[0]
+}
+
+func (el *Element[K, V]) Prev() *Element[K, V] {
+	return el.prevs[0]
+}
+
+func newElement[K, V any](key K, val V, rh *randomHeightGenerator) *Element[K, V] {
+	height := rh.height()
+	return &Element[K, V]{
+		key, val,
+		make([]*Element[K, V], height),
+		make([]*Element[K, V], height),
+	}
+}
@@ -1,6 +1,7 @@
 package duplist
 
 import (
+	"math/bits"
 	"math/rand"
 	"time"
 )
@@ -16,31 +17,24 @@ func newRandomHeightGenerator(maxHeight int, src rand.Source) *randomHeightGener
 	return rh
 }
 
-// true=heads, false=tails
-func (rh *randomHeightGenerator) flipCoin() bool {
-	if rh.src.Int63()%2 == 0 {
-		return true
-	}
-	return false
-}
-
-// SetRandSource sets the random number generator used to perform the coin flips
-// to determine an element's "height". It is not thread safe and is meant to be
-// called only once before using the package.
+// setRandSource sets the random number generator used to perform the coin
+// flips to determine an element's "height".
 // If src is nil, time.Now().UnixNano() is used to seed.
 func (rh *randomHeightGenerator) setRandSource(src rand.Source) {
-	if src != nil {
-		rh.src = src
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
 	}
-	rh.src = rand.NewSource(time.Now().UnixNano())
+	rh.src = src
 }
 
+// height flips a coin per level, each one a bit of a single random number:
+// the height is 1 plus the number of heads (ones) before the first tails,
+// up to maxHeight. maxHeight is less than 64, and Int63 leaves the top bit
+// zero, so that there's always a tails within reach.
 func (rh *randomHeightGenerator) height() int {
-	var n int
-	for n = 1; n < rh.maxHeight; n++ {
-		if !rh.flipCoin() {
-			break
-		}
+	n := 1 + bits.TrailingZeros64(^uint64(rh.src.Int63()))
+	if n > rh.maxHeight {
+		return rh.maxHeight
 	}
 	return n
 }
@@ -1,32 +1,47 @@
 package duplist
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestFlipCoin(t *testing.T) {
+func TestHeight(t *testing.T) {
 	rh := newRandomHeightGenerator(24, nil)
-	var heads, tails float32
-	assert.True(t, heads == 0.0)
+	var heights [25]float32
 	for i := 0; i < 100000; i++ {
-		if rh.flipCoin() {
-			heads++
-		} else {
-			tails++
-		}
+		h := rh.height()
+		assert.True(t, h >= 1 && h <= 24)
+		heights[h]++
+	}
+
+	// every level is half as likely as the one below, 50-50 coin flips
+	for h := 1; h <= 4; h++ {
+		ratio := heights[h] / heights[h+1]
+		assert.True(t, ratio < 2.2 && ratio > 1.8,
+			"50-50 probability means ratio is close to 2")
+	}
+
+	rh = newRandomHeightGenerator(3, nil)
+	for i := 0; i < 1000; i++ {
+		assert.True(t, rh.height() <= 3)
+	}
+}
+
+func TestRandSource(t *testing.T) {
+	a := newRandomHeightGenerator(24, rand.NewSource(42))
+	b := newRandomHeightGenerator(24, rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, a.height(), b.height())
 	}
-	ratio := heads / tails
-	assert.True(t, ratio < 1.05 && ratio > 0.95,
-		"50-50 probability means ratio is close to 1")
 }
 
-func BenchmarkFlipCoin(b *testing.B) {
-	// must not take to long to flip a coin
+func BenchmarkHeight(b *testing.B) {
+	// must not take to long to pick a height
 	rh := newRandomHeightGenerator(24, nil)
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		rh.flipCoin()
+		rh.height()
 	}
 }
@@ -75,6 +75,18 @@ func TestTimeStringDuplist(t *testing.T) {
 	assert.Equal(t, "", vals)
 }
 
+func TestTimeStringInit(t *testing.T) {
+
+	var d TimeString
+	d.Init(24)
+
+	now := time.Now()
+	d.Insert(now.Add(time.Second), "b")
+	d.Insert(now, "a")
+	assert.Equal(t, "a", d.First().Val())
+	assert.Equal(t, "b", d.Last().Val())
+}
+
 func BenchmarkTimeStringDuplistInsert(b *testing.B) {
 
 	N := 1000 * 10
@@ -73,6 +73,20 @@ func TestUint64StringDuplist(t *testing.T) {
 	assert.Equal(t, "", vals)
 }
 
+func TestUint64StringInit(t *testing.T) {
+
+	var d Uint64String
+	d.Init(24)
+
+	d.Insert(2, "b")
+	d.Insert(1, "a")
+	assert.Equal(t, "a", d.First().Val())
+	assert.Equal(t, "b", d.Last().Val())
+
+	var dl DupList[uint64, string]
+	assert.Panics(t, func() { dl.Init(24, nil) })
+}
+
 func BenchmarkUint64StringDuplistInsert(b *testing.B) {
 
 	N := 1000 * 10
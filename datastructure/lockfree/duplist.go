@@ -0,0 +1,240 @@
+// Package lockfree implements a skiplist safe for concurrent use without
+// locks, after Herlihy and Shavit's LockFreeSkipList, itself based on
+// Fraser's.
+package lockfree
+
+import (
+	"math/bits"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// DupList is the concurrent counterpart of duplist.DupList, with the same
+// duplicate key semantics: elements with duplicate keys are adjacent, with a
+// later insert placed left of earlier ones, and elements are deleted by
+// pointer. All methods may be called concurrently.
+//
+// Elements are deleted in two steps. Marking an element's links removes it
+// logically, and is what makes DelElement take effect. Unlinking it follows,
+// by the deleting goroutine or any other traversing the list. Iteration skips
+// marked elements, but is weakly consistent: it may or may not see concurrent
+// inserts and deletes.
+type DupList[K, V any] struct {
+	head      *Element[K, V] // sentinel, with maxHeight links
+	maxHeight int
+	compare   func(a, b K) int
+	seq       uint64 // atomically, orders duplicate keys
+	len       int64  // atomically
+	rand      uint64 // atomically, splitmix64 state drawing heights
+}
+
+// link is an immutable (successor, mark) pair, so that both can be compared
+// and swapped at once. A marked link means its element is deleted.
+type link[K, V any] struct {
+	next   *Element[K, V]
+	marked bool
+}
+
+type Element[K, V any] struct {
+	key   K
+	val   V
+	seq   uint64
+	nexts []atomic.Pointer[link[K, V]]
+}
+
+func (el *Element[K, V]) Key() K {
+	return el.key
+}
+
+func (el *Element[K, V]) Val() V {
+	return el.val
+}
+
+// Next returns the next element not deleted, or nil.
+func (el *Element[K, V]) Next() *Element[K, V] {
+	return el.nexts[0].Load().next.live()
+}
+
+// live returns el or the first element after it which is not deleted.
+func (el *Element[K, V]) live() *Element[K, V] {
+	for el != nil {
+		l := el.nexts[0].Load()
+		if !l.marked {
+			return el
+		}
+		el = l.next
+	}
+	return nil
+}
+
+func New[K, V any](maxHeight int, compare func(a, b K) int) *DupList[K, V] {
+	return NewWithSource[K, V](maxHeight, compare, nil)
+}
+
+// NewWithSource is New with element heights drawn from a generator seeded by
+// src, such that lists created with equally seeded sources and filled the same
+// way by a single goroutine are laid out the same way. A nil src means the
+// generator is seeded with the current time.
+func NewWithSource[K, V any](maxHeight int, compare func(a, b K) int,
+	src rand.Source) *DupList[K, V] {
+
+	if maxHeight < 2 || maxHeight >= 64 {
+		panic("maxHeight must be between 2 and 64")
+	}
+	seed := uint64(time.Now().UnixNano())
+	if src != nil {
+		seed = uint64(src.Int63())
+	}
+
+	dl := &DupList[K, V]{
+		head:      &Element[K, V]{nexts: make([]atomic.Pointer[link[K, V]], maxHeight)},
+		maxHeight: maxHeight,
+		compare:   compare,
+		rand:      seed,
+	}
+	for i := range dl.head.nexts {
+		dl.head.nexts[i].Store(&link[K, V]{})
+	}
+	return dl
+}
+
+// First returns the first element not deleted, or nil if there is none.
+func (dl *DupList[K, V]) First() *Element[K, V] {
+	return dl.head.Next()
+}
+
+// Len returns the number of elements inserted and not deleted.
+func (dl *DupList[K, V]) Len() int {
+	return int(atomic.LoadInt64(&dl.len))
+}
+
+func (dl *DupList[K, V]) Insert(key K, val V) *Element[K, V] {
+	el := &Element[K, V]{
+		key:   key,
+		val:   val,
+		seq:   atomic.AddUint64(&dl.seq, 1),
+		nexts: make([]atomic.Pointer[link[K, V]], dl.height()),
+	}
+
+	var preds, succs [64]*Element[K, V]
+	for {
+		dl.find(el, &preds, &succs)
+		for i := range el.nexts {
+			el.nexts[i].Store(&link[K, V]{next: succs[i]})
+		}
+
+		// linking the bottom level inserts el
+		if dl.swap(preds[0], 0, succs[0], el) {
+			break
+		}
+	}
+	atomic.AddInt64(&dl.len, 1)
+
+	// the upper levels only speed up searches
+	for i := 1; i < len(el.nexts); i++ {
+		for {
+			if dl.swap(preds[i], i, succs[i], el) {
+				break
+			}
+
+			dl.find(el, &preds, &succs)
+			l := el.nexts[i].Load()
+			if l.marked {
+				return el // deleted meanwhile, don't bother
+			}
+			if l.next != succs[i] &&
+				!el.nexts[i].CompareAndSwap(l, &link[K, V]{next: succs[i]}) {
+				return el
+			}
+		}
+	}
+	return el
+}
+
+// DelElement deletes el, unless it's already deleted.
+func (dl *DupList[K, V]) DelElement(el *Element[K, V]) {
+	if el == nil {
+		return
+	}
+
+	for i := len(el.nexts) - 1; i >= 1; i-- {
+		dl.mark(el, i)
+	}
+	if dl.mark(el, 0) {
+		atomic.AddInt64(&dl.len, -1)
+		var preds, succs [64]*Element[K, V]
+		dl.find(el, &preds, &succs) // unlinks el
+	}
+}
+
+// mark marks the i-th link of el, returning false if it was marked already.
+func (dl *DupList[K, V]) mark(el *Element[K, V], i int) bool {
+	for {
+		l := el.nexts[i].Load()
+		if l.marked {
+			return false
+		}
+		if el.nexts[i].CompareAndSwap(l, &link[K, V]{l.next, true}) {
+			return true
+		}
+	}
+}
+
+// swap replaces the unmarked i-th link of pred to old by one to new.
+func (dl *DupList[K, V]) swap(pred *Element[K, V], i int, old, new *Element[K, V]) bool {
+	l := pred.nexts[i].Load()
+	if l.marked || l.next != old {
+		return false
+	}
+	return pred.nexts[i].CompareAndSwap(l, &link[K, V]{next: new})
+}
+
+// before orders elements by key, then later inserts first.
+func (dl *DupList[K, V]) before(a, b *Element[K, V]) bool {
+	if c := dl.compare(a.key, b.key); c != 0 {
+		return c < 0
+	}
+	return a.seq > b.seq
+}
+
+// find fills preds and succs with the elements around the position of el at
+// every level, unlinking the marked elements it comes across.
+func (dl *DupList[K, V]) find(el *Element[K, V], preds, succs *[64]*Element[K, V]) {
+retry:
+	pred := dl.head
+	for i := dl.maxHeight - 1; i >= 0; i-- {
+		curr := pred.nexts[i].Load().next
+		for curr != nil {
+			l := curr.nexts[i].Load()
+			if l.marked {
+				if !dl.swap(pred, i, curr, l.next) {
+					goto retry
+				}
+				curr = l.next
+				continue
+			}
+			if !dl.before(curr, el) {
+				break
+			}
+			pred, curr = curr, l.next
+		}
+		preds[i], succs[i] = pred, curr
+	}
+}
+
+// height flips a coin per level, each one a bit of a single random number,
+// see duplist. The number is the splitmix64 output of the state advanced by a
+// single atomic add, so that concurrent inserts never wait on each other.
+func (dl *DupList[K, V]) height() int {
+	r := atomic.AddUint64(&dl.rand, 0x9e3779b97f4a7c15)
+	r = (r ^ r>>30) * 0xbf58476d1ce4e5b9
+	r = (r ^ r>>27) * 0x94d049bb133111eb
+	r ^= r >> 31
+
+	n := 1 + bits.TrailingZeros64(^r)
+	if n > dl.maxHeight {
+		return dl.maxHeight
+	}
+	return n
+}
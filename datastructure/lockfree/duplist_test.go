@@ -0,0 +1,212 @@
+package lockfree
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/datastructure/duplist"
+)
+
+func vals(d *TimeString) string {
+	var s string
+	for it := d.First(); it != nil; it = it.Next() {
+		s += it.Val()
+	}
+	return s
+}
+
+func TestTimeString(t *testing.T) {
+
+	d := NewTimeString(24)
+	assert.Nil(t, d.First())
+
+	now := time.Now()
+	fooEl := d.Insert(now.Add(50*time.Millisecond), "foo")
+	d.Insert(now.Add(50*time.Millisecond), "bar")
+	bazEl := d.Insert(now.Add(50*time.Millisecond), "baz")
+	quxEl := d.Insert(now.Add(70*time.Millisecond), "qux")
+	d.Insert(now.Add(30*time.Millisecond), "first")
+	lastEl := d.Insert(now.Add(99*time.Millisecond), "last")
+	assert.Equal(t, "foo", fooEl.Val())
+	assert.Equal(t, 6, d.Len())
+
+	first := d.First()
+	assert.Equal(t, now.Add(30*time.Millisecond), first.Key())
+	assert.Equal(t, "firstbazbarfooquxlast", vals(d))
+
+	d.DelElement(fooEl)
+	assert.Equal(t, "firstbazbarquxlast", vals(d))
+	d.DelElement(bazEl)
+	d.DelElement(quxEl)
+	d.DelElement(first)
+	assert.Equal(t, "barlast", vals(d))
+	assert.Equal(t, 2, d.Len())
+
+	// deleting twice is harmless
+	d.DelElement(first)
+	d.DelElement(nil)
+	assert.Equal(t, 2, d.Len())
+
+	d.DelElement(lastEl)
+	d.DelElement(d.First())
+	assert.Nil(t, d.First())
+	assert.Equal(t, 0, d.Len())
+}
+
+func TestConcurrent(t *testing.T) {
+
+	d := NewTimeStringWithSource(16, rand.NewSource(1))
+	base := time.Now()
+
+	const goroutines, perGoroutine = 8, 2000
+	var wg sync.WaitGroup
+	kept := make([][]*TimeStringElement, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < perGoroutine; i++ {
+				el := d.Insert(base.Add(time.Duration(r.Intn(500))), "")
+				if i%2 == 0 {
+					d.DelElement(el)
+				} else {
+					kept[g] = append(kept[g], el)
+				}
+
+				// concurrent readers and deleters of the first element
+				if f := d.First(); f != nil && i%100 == 0 {
+					f.Next()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Equal(t, goroutines*perGoroutine/2, d.Len())
+
+	n := 0
+	var prev *TimeStringElement
+	for it := d.First(); it != nil; it = it.Next() {
+		if prev != nil {
+			assert.False(t, it.Key().Before(prev.Key()))
+		}
+		prev = it
+		n++
+	}
+	assert.Equal(t, d.Len(), n)
+
+	// all levels are sorted and only hold live elements
+	for i := range d.head.nexts {
+		for el := d.head.nexts[i].Load().next; el != nil; el = el.nexts[i].Load().next {
+			assert.False(t, el.nexts[0].Load().marked)
+		}
+	}
+
+	// concurrent deletes of the same elements
+	for g := 0; g < goroutines; g++ {
+		wg.Add(2)
+		for j := 0; j < 2; j++ {
+			go func(els []*TimeStringElement) {
+				defer wg.Done()
+				for _, el := range els {
+					d.DelElement(el)
+				}
+			}(kept[g])
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, 0, d.Len())
+	assert.Nil(t, d.First())
+}
+
+// mutexTimeString is duplist.TimeString made safe for concurrent use the
+// usual way, for comparison.
+type mutexTimeString struct {
+	sync.Mutex
+	*duplist.TimeString
+}
+
+func TestHeight(t *testing.T) {
+	d := NewWithSource[int, string](24, nil, rand.NewSource(42))
+	same := NewWithSource[int, string](24, nil, rand.NewSource(42))
+
+	var heights [25]float32
+	for i := 0; i < 100000; i++ {
+		h := d.height()
+		assert.True(t, h >= 1 && h <= 24)
+		assert.Equal(t, h, same.height())
+		heights[h]++
+	}
+
+	// every level is half as likely as the one below, 50-50 coin flips
+	for h := 1; h <= 4; h++ {
+		ratio := heights[h] / heights[h+1]
+		assert.True(t, ratio < 2.2 && ratio > 1.8,
+			"50-50 probability means ratio is close to 2")
+	}
+}
+
+func BenchmarkParallelInsertDelete(b *testing.B) {
+	b.Run("lockfree", func(b *testing.B) {
+		d := NewTimeString(24)
+		b.RunParallel(func(pb *testing.PB) {
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			for pb.Next() {
+				el := d.Insert(time.Unix(0, r.Int63()), "")
+				d.DelElement(el)
+			}
+		})
+	})
+
+	b.Run("mutex", func(b *testing.B) {
+		d := &mutexTimeString{TimeString: duplist.NewTimeString(24)}
+		b.RunParallel(func(pb *testing.PB) {
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			for pb.Next() {
+				d.Lock()
+				el := d.Insert(time.Unix(0, r.Int63()), "")
+				d.Unlock()
+				d.Lock()
+				d.DelElement(el)
+				d.Unlock()
+			}
+		})
+	})
+}
+
+func BenchmarkParallelFirst(b *testing.B) {
+	const n = 100 * 1000
+	r := rand.New(rand.NewSource(1))
+
+	b.Run("lockfree", func(b *testing.B) {
+		d := NewTimeString(24)
+		for i := 0; i < n; i++ {
+			d.Insert(time.Unix(0, r.Int63()), "")
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				d.First()
+			}
+		})
+	})
+
+	b.Run("mutex", func(b *testing.B) {
+		d := &mutexTimeString{TimeString: duplist.NewTimeString(24)}
+		for i := 0; i < n; i++ {
+			d.Insert(time.Unix(0, r.Int63()), "")
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				d.Lock()
+				d.First()
+				d.Unlock()
+			}
+		})
+	})
+}
@@ -0,0 +1,30 @@
+package lockfree
+
+import (
+	"math/rand"
+	"time"
+)
+
+// TimeString is the concurrent counterpart of duplist.TimeString.
+type TimeString = DupList[time.Time, string]
+
+type TimeStringElement = Element[time.Time, string]
+
+func NewTimeString(maxHeight int) *TimeString {
+	return New[time.Time, string](maxHeight, compareTime)
+}
+
+func NewTimeStringWithSource(maxHeight int, src rand.Source) *TimeString {
+	return NewWithSource[time.Time, string](maxHeight, compareTime, src)
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
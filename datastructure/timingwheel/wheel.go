@@ -0,0 +1,244 @@
+// Package timingwheel implements a hierarchical timing wheel, which orders
+// values by expiry with O(1) inserts and deletes, at the cost of a resolution
+// of one tick.
+package timingwheel
+
+import (
+	"time"
+)
+
+const (
+	slotBits = 6
+	slots    = 1 << slotBits
+	levels   = 8 // 64^8 ticks, 8900 years of milliseconds
+)
+
+// Wheel holds values to be expired once their expiry has passed, see
+// Advance. Level 0 of the wheel has a slot per tick for the next 64 ticks,
+// level 1 a slot per 64 ticks for the next 64*64 ticks, and so on. Whenever
+// the current tick wraps around a level, the entries of that level's next slot
+// are cascaded down to the lower levels.
+// A Wheel is not safe for concurrent use.
+type Wheel struct {
+	tick    time.Duration
+	origin  time.Time
+	current int64 // ticks since origin, whose entries have all been expired
+	slots   [levels][slots]*Entry
+	first   [levels][slots]int64 // earliest expiry tick in each slot, see Due
+	n       [levels]int          // entries per level
+	len     int
+}
+
+// Entry is a value in the Wheel. Its fields are only read and written by the
+// Wheel.
+type Entry struct {
+	expiry      time.Time
+	val         string
+	level, slot int // level is -1 outside of the wheel
+	prev, next  *Entry
+}
+
+func (e *Entry) Key() time.Time {
+	return e.expiry
+}
+
+func (e *Entry) Val() string {
+	return e.val
+}
+
+// New returns a Wheel of the given resolution, starting at now.
+func New(tick time.Duration, now time.Time) *Wheel {
+	if tick <= 0 {
+		panic("tick must be positive")
+	}
+	return &Wheel{tick: tick, origin: now}
+}
+
+// Len returns the number of entries in the wheel.
+func (w *Wheel) Len() int {
+	return w.len
+}
+
+// Insert adds val, to be expired by the first Advance to now >= expiry, or by
+// the next one if expiry has already passed.
+func (w *Wheel) Insert(expiry time.Time, val string) *Entry {
+	e := &Entry{expiry: expiry, val: val}
+	w.place(e, false)
+	w.len++
+	return e
+}
+
+// DelElement removes e, unless it's been expired or removed already.
+func (w *Wheel) DelElement(e *Entry) {
+	if e == nil || e.level < 0 {
+		return
+	}
+	w.unlink(e)
+	w.len--
+}
+
+// Due reports whether Advance to now may expire entries. Entries merely
+// cascading down the wheel don't make it due, Advance catching up on those
+// later on. Due may report entries deleted since they were inserted, at most
+// until the next Advance.
+func (w *Wheel) Due(now time.Time) bool {
+	target := w.ticks(now, false)
+	if w.len == 0 || target <= w.current {
+		return false
+	}
+
+	// the slots of each level which Advance would expire or cascade, i.e.
+	// those of the ticks of level 0, or the spans of the higher levels,
+	// starting after the current one and up to target
+	for l := 0; l < levels; l++ {
+		from, to := w.current>>(slotBits*l)+1, target>>(slotBits*l)
+		if to-from >= slots {
+			from, to = 0, slots-1
+		}
+		for i := from; i <= to; i++ {
+			s := i & (slots - 1)
+			if w.slots[l][s] != nil && w.first[l][s] <= target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Advance moves the wheel forward to now, calling expire with each entry
+// whose expiry has passed, after removing it. Entries expiring within the
+// same tick are passed in no particular order. expire may insert and delete
+// entries.
+func (w *Wheel) Advance(now time.Time, expire func(e *Entry)) {
+	target := w.ticks(now, false)
+
+	for w.current < target {
+		if w.len == 0 {
+			w.current = target
+			return
+		}
+
+		// with the levels below l empty, nothing but empty cascades happens
+		// until the current tick wraps around level l
+		l := 0
+		for l < levels-1 && w.n[l] == 0 {
+			l++
+		}
+		if l > 0 {
+			w.current = (w.current>>(slotBits*l)+1)<<(slotBits*l) - 1
+			if w.current >= target {
+				w.current = target
+				return
+			}
+		}
+
+		w.current++
+		w.cascade()
+
+		head := &w.slots[0][w.current&(slots-1)]
+		for *head != nil {
+			e := *head
+			w.unlink(e)
+			w.len--
+			expire(e)
+		}
+	}
+}
+
+// Each calls yield with all entries in no particular order until yield
+// returns false.
+func (w *Wheel) Each(yield func(e *Entry) bool) {
+	for l := range w.slots {
+		for s := range w.slots[l] {
+			for e := w.slots[l][s]; e != nil; e = e.next {
+				if !yield(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// cascade moves the entries of the higher levels which wrap around at the
+// current tick down to the lower levels.
+func (w *Wheel) cascade() {
+	for l := 1; l < levels; l++ {
+		if w.current&(1<<(slotBits*l)-1) != 0 {
+			return
+		}
+
+		s := (w.current >> (slotBits * l)) & (slots - 1)
+		e := w.slots[l][s]
+		w.slots[l][s] = nil
+		for e != nil {
+			next := e.next
+			w.n[l]--
+			w.place(e, true)
+			e = next
+		}
+	}
+}
+
+// place links e into the slot of its expiry. The slot of the current tick is
+// only expired after cascading, and otherwise not before it comes around
+// again.
+func (w *Wheel) place(e *Entry, cascading bool) {
+	t := w.ticks(e.expiry, true)
+	if t <= w.current {
+		if cascading {
+			t = w.current
+		} else {
+			t = w.current + 1
+		}
+	}
+
+	delta := t - w.current
+	l := 0
+	for l < levels-1 && delta >= 1<<(slotBits*(l+1)) {
+		l++
+	}
+	if limit := int64(1)<<(slotBits*levels) - 1; delta > limit {
+		t = w.current + limit // cascaded again later on
+	}
+
+	e.level = l
+	e.slot = int((t >> (slotBits * l)) & (slots - 1))
+	w.n[l]++
+	// deleted entries leave first behind until the slot is emptied by
+	// Advance, erring on the side of Due
+	if exp := w.ticks(e.expiry, true); w.slots[l][e.slot] == nil || exp < w.first[l][e.slot] {
+		w.first[l][e.slot] = exp
+	}
+	e.prev = nil
+	e.next = w.slots[l][e.slot]
+	if e.next != nil {
+		e.next.prev = e
+	}
+	w.slots[l][e.slot] = e
+}
+
+func (w *Wheel) unlink(e *Entry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		w.slots[e.level][e.slot] = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	}
+	w.n[e.level]--
+	e.prev, e.next, e.level = nil, nil, -1
+}
+
+// ticks returns the number of ticks from the origin to t, rounded up if ceil.
+func (w *Wheel) ticks(t time.Time, ceil bool) int64 {
+	d := t.Sub(w.origin)
+	if d < 0 {
+		return 0
+	}
+	n := int64(d / w.tick)
+	if ceil && d%w.tick != 0 {
+		n++
+	}
+	return n
+}
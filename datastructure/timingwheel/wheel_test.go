@@ -0,0 +1,223 @@
+package timingwheel
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/datastructure/duplist"
+)
+
+func TestWheel(t *testing.T) {
+	start := time.Now()
+	w := New(time.Millisecond, start)
+	assert.False(t, w.Due(start.Add(time.Hour)))
+
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	a := w.Insert(at(5*time.Millisecond), "a")
+	w.Insert(at(5*time.Millisecond+time.Microsecond), "b")
+	w.Insert(at(100*time.Millisecond), "c") // level 1
+	w.Insert(at(10*time.Second), "d")       // level 2
+	w.Insert(at(-time.Second), "past")
+	e := w.Insert(at(time.Hour), "e")
+	assert.Equal(t, 6, w.Len())
+	assert.Equal(t, "a", a.Val())
+
+	var expired []string
+	advance := func(d time.Duration) {
+		w.Advance(at(d), func(e *Entry) {
+			assert.False(t, at(d).Before(e.Key()), e.Val())
+			expired = append(expired, e.Val())
+		})
+	}
+
+	advance(1 * time.Millisecond)
+	assert.Equal(t, []string{"past"}, expired)
+	assert.True(t, w.Due(at(5*time.Millisecond)))
+
+	advance(5 * time.Millisecond)
+	assert.Equal(t, []string{"past", "a"}, expired)
+	advance(6 * time.Millisecond)
+	assert.Equal(t, []string{"past", "a", "b"}, expired)
+
+	advance(99 * time.Millisecond)
+	assert.Equal(t, 3, len(expired))
+	advance(100 * time.Millisecond)
+	assert.Equal(t, "c", expired[3])
+
+	w.DelElement(e)
+	w.DelElement(e)
+	w.DelElement(a) // expired already
+	assert.Equal(t, 1, w.Len())
+
+	advance(time.Hour)
+	assert.Equal(t, []string{"past", "a", "b", "c", "d"}, expired)
+	assert.Equal(t, 0, w.Len())
+	assert.False(t, w.Due(at(2*time.Hour)))
+
+	// inserted while advancing
+	w.Insert(at(time.Hour+10*time.Millisecond), "f")
+	w.Advance(at(2*time.Hour), func(e *Entry) {
+		expired = append(expired, e.Val())
+		if e.Val() == "f" {
+			w.Insert(at(time.Hour+20*time.Millisecond), "g")
+		}
+	})
+	assert.Equal(t, []string{"f", "g"}, expired[5:])
+
+	// cascading without expiring isn't due, nor is it left to Advance tick by
+	// tick once due
+	w.Insert(at(3*time.Hour+time.Second), "h")
+	assert.False(t, w.Due(at(2*time.Hour+64*time.Millisecond)))
+	assert.False(t, w.Due(at(3*time.Hour)))
+	assert.True(t, w.Due(at(3*time.Hour+time.Second)))
+	w.Advance(at(3*time.Hour+time.Second), func(e *Entry) {
+		expired = append(expired, e.Val())
+	})
+	assert.Equal(t, "h", expired[7])
+
+	// beyond the top level
+	w = New(time.Nanosecond, start)
+	w.Insert(start.AddDate(1000, 0, 0), "far")
+	w.Insert(at(time.Nanosecond), "near")
+	var vals []string
+	w.Each(func(e *Entry) bool { vals = append(vals, e.Val()); return true })
+	assert.ElementsMatch(t, []string{"far", "near"}, vals)
+}
+
+func TestWheelRandom(t *testing.T) {
+	start := time.Now()
+	w := New(time.Millisecond, start)
+	r := rand.New(rand.NewSource(1))
+
+	want := map[string]time.Time{}
+	entries := map[string]*Entry{}
+	for i := 0; i < 10000; i++ {
+		k := strconv.Itoa(i)
+		exp := start.Add(time.Duration(r.Int63n(int64(20 * time.Second))))
+		want[k] = exp
+		entries[k] = w.Insert(exp, k)
+	}
+	for i := 0; i < 10000; i += 3 {
+		k := strconv.Itoa(i)
+		w.DelElement(entries[k])
+		delete(want, k)
+	}
+	assert.Equal(t, len(want), w.Len())
+
+	var got []*Entry
+	for now := start; w.Len() > 0; now = now.Add(time.Duration(r.Int63n(int64(50 * time.Millisecond)))) {
+		due, n := w.Due(now), len(got)
+		w.Advance(now, func(e *Entry) {
+			assert.False(t, now.Before(e.Key()))
+			assert.True(t, now.Sub(e.Key()) < 50*time.Millisecond+time.Millisecond)
+			got = append(got, e)
+		})
+		assert.True(t, due || len(got) == n) // deleted entries may be reported
+	}
+
+	assert.Equal(t, len(want), len(got))
+	for _, e := range got {
+		assert.Equal(t, want[e.Val()], e.Key())
+	}
+}
+
+func TestWheelDueFarFuture(t *testing.T) {
+	start := time.Now()
+	w := New(time.Millisecond, start)
+	r := rand.New(rand.NewSource(1))
+
+	// all in the level 3 slot spanning 3407s to 3670s
+	for i := 0; i < 200*1000; i++ {
+		w.Insert(start.Add(3600*time.Second+time.Duration(r.Int63n(int64(50*time.Second)))), "")
+	}
+
+	// crossed into the slot, Due doesn't go through its entries
+	now := start.Add(3500 * time.Second)
+	began := time.Now()
+	for i := 0; i < 1000; i++ {
+		assert.False(t, w.Due(now.Add(time.Duration(i)*time.Millisecond)))
+	}
+	assert.True(t, time.Since(began) < 50*time.Millisecond, time.Since(began))
+	assert.True(t, w.Due(start.Add(3650*time.Second)))
+}
+
+// benchKeys is the number of keys in the benchmarked indexes.
+const benchKeys = 2 * 1000 * 1000
+
+// benchExpiries returns expiries spread over twice as many microseconds as
+// there are keys from start.
+func benchExpiries(start time.Time) []time.Time {
+	r := rand.New(rand.NewSource(1))
+	exps := make([]time.Time, 1<<16)
+	for i := range exps {
+		exps[i] = start.Add(time.Duration(r.Int63n(2*benchKeys)) * time.Microsecond)
+	}
+	return exps
+}
+
+func BenchmarkInsertDelete(b *testing.B) {
+	start := time.Now()
+	exps := benchExpiries(start)
+
+	b.Run("timingwheel", func(b *testing.B) {
+		w := New(time.Millisecond, start)
+		for i := 0; i < benchKeys; i++ {
+			w.Insert(exps[i&(len(exps)-1)], "")
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			w.DelElement(w.Insert(exps[i&(len(exps)-1)], ""))
+		}
+	})
+
+	b.Run("duplist", func(b *testing.B) {
+		d := duplist.NewTimeString(24)
+		for i := 0; i < benchKeys; i++ {
+			d.Insert(exps[i&(len(exps)-1)], "")
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			d.DelElement(d.Insert(exps[i&(len(exps)-1)], ""))
+		}
+	})
+}
+
+// BenchmarkExpire measures expiring a key and inserting another in its place,
+// the clock moving a microsecond per op so that the number of keys stays
+// around benchKeys.
+func BenchmarkExpire(b *testing.B) {
+	start := time.Now()
+	exps := benchExpiries(start)
+
+	b.Run("timingwheel", func(b *testing.B) {
+		w := New(time.Millisecond, start)
+		for i := 0; i < benchKeys; i++ {
+			w.Insert(exps[i&(len(exps)-1)], "")
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			now := start.Add(time.Duration(i) * time.Microsecond)
+			w.Advance(now, func(*Entry) {})
+			w.Insert(now.Add(exps[i&(len(exps)-1)].Sub(start)), "")
+		}
+	})
+
+	b.Run("duplist", func(b *testing.B) {
+		d := duplist.NewTimeString(24)
+		for i := 0; i < benchKeys; i++ {
+			d.Insert(exps[i&(len(exps)-1)], "")
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			now := start.Add(time.Duration(i) * time.Microsecond)
+			for f := d.First(); f != nil && now.After(f.Key()); f = d.First() {
+				d.DelElement(f)
+			}
+			d.Insert(now.Add(exps[i&(len(exps)-1)].Sub(start)), "")
+		}
+	})
+}
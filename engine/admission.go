@@ -0,0 +1,32 @@
+package engine
+
+// admit tells whether a fetched value of key and size is worth evicting for,
+// i.e. whether key is estimated to be accessed more frequently than the first
+// victim of the default eviction policy.
+// still holding top level lock
+func (e *Engine) admit(key string, size int64) bool {
+
+	if !e.admission || e.payloadTotal+size <= e.maxPayloadTotal {
+		return true
+	}
+	if _, ok := e.data[key]; ok {
+		return true // replacing, no eviction needed for it
+	}
+
+	var victim string
+	e.stats.Victims(func(k string) bool {
+		if _, ok := e.data[k]; ok && k != key {
+			victim = k
+			return false
+		}
+		return true // keys accessed but not cached
+	})
+	if victim == "" {
+		return true
+	}
+
+	e.stats.Lock()
+	defer e.stats.Unlock()
+
+	return e.stats.cms.Count([]byte(key)) > e.stats.cms.Count([]byte(victim))
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func TestMaxItemBytes(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.CustomLengthOrigin{}
+	opts.MaxItemBytes = opts.MaxPayloadTotalBytes + 1
+	_, err := NewEngine(&opts)
+	assert.NotNil(t, err)
+
+	opts.MaxItemBytes = 1000
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	r, err := e.Get("small/1000")
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, r.Len())
+	assert.NotNil(t, e.tryget("small/1000"))
+
+	r, err = e.Get("large/1001")
+	assert.Nil(t, err)
+	assert.Equal(t, 1001, r.Len())
+	assert.Nil(t, e.tryget("large/1001"))
+
+	rc, err := e.GetStream(context.Background(), "large/5000")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, 5000, len(b))
+	assert.Nil(t, e.tryget("large/5000"))
+
+	assert.Equal(t, ErrTooLarge, e.Set("large", make([]byte, 1001), nil))
+
+	s := e.Stats()
+	assert.Equal(t, uint64(2), s.Rejections)
+	assert.Equal(t, int64(1000), s.PayloadBytes)
+}
+
+func TestAdmission(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.CustomLengthOrigin{}
+	opts.MaxPayloadTotalBytes = 10 * 1000 * 1000 // 100 values
+	opts.AccessBufferSize = 100                  // nothing dropped
+	opts.Admission = true
+
+	lruOpts := opts
+	lruOpts.EvictionPolicy = NewLRUPolicy()
+	_, err := NewEngine(&lruOpts)
+	assert.NotNil(t, err)
+
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	for i := 0; i < 100; i++ {
+		e.Get(strconv.Itoa(i) + "/100000")
+		e.Get(strconv.Itoa(i) + "/100000")
+	}
+	e.accesses.drain(e.stats.addBatch)
+	assert.Equal(t, 100, e.Stats().Keys)
+
+	// a key not colliding with others in the sketch
+	var key string
+	for i := 0; key == ""; i++ {
+		k := "new" + strconv.Itoa(i) + "/100000"
+		if e.stats.cms.Count([]byte(k)) == 0 {
+			key = k
+		}
+	}
+
+	// not more frequent than the others, accessed twice each
+	for i := 0; i < 3; i++ {
+		e.Get(key)
+		e.accesses.drain(e.stats.addBatch)
+	}
+	assert.Nil(t, e.tryget(key))
+	assert.Equal(t, uint64(3), e.Stats().Rejections)
+	assert.Equal(t, 100, e.Stats().Keys)
+
+	e.Get(key)
+	assert.NotNil(t, e.tryget(key))
+	assert.True(t, e.Stats().Evictions > 0)
+
+	// Set bypasses admission
+	assert.Nil(t, e.Set("set", make([]byte, 100000), nil))
+	assert.NotNil(t, e.tryget("set"))
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"container/list"
+	"sync"
+)
+
+type arcEntry struct {
+	key string
+	ll  *list.List
+}
+
+type arcPolicy struct {
+	sync.Mutex
+	p              int        // target length of t1
+	t1, t2, b1, b2 *list.List // b1 and b2 are ghosts of evicted keys
+	m              map[string]*list.Element
+}
+
+// NewARCPolicy returns an Adaptive Replacement Cache EvictionPolicy, which
+// balances between evicting keys seen once recently (t1) and keys seen at
+// least twice recently (t2), adapting the balance whenever a recently evicted
+// key comes back into the cache. The cache's capacity is taken to be the
+// number of keys it holds.
+func NewARCPolicy() EvictionPolicy {
+	return &arcPolicy{
+		t1: list.New(), t2: list.New(), b1: list.New(), b2: list.New(),
+		m: make(map[string]*list.Element),
+	}
+}
+
+func (arc *arcPolicy) OnAccess(key string) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	if el, ok := arc.m[key]; ok && arc.resident(el) {
+		arc.move(el, arc.t2)
+	}
+}
+
+func (arc *arcPolicy) OnInsert(key string, _ int) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	el, ok := arc.m[key]
+	switch {
+
+	case !ok:
+		arc.m[key] = arc.t1.PushFront(&arcEntry{key, arc.t1})
+
+	case arc.resident(el):
+		arc.move(el, arc.t2)
+
+	case el.Value.(*arcEntry).ll == arc.b1: // t1 too short
+		arc.p += arcDelta(arc.b2.Len(), arc.b1.Len())
+		if c := arc.t1.Len() + arc.t2.Len() + 1; arc.p > c {
+			arc.p = c
+		}
+		arc.move(el, arc.t2)
+
+	default: // b2, t2 too short
+		if arc.p -= arcDelta(arc.b1.Len(), arc.b2.Len()); arc.p < 0 {
+			arc.p = 0
+		}
+		arc.move(el, arc.t2)
+	}
+
+	// ghosts are bounded by the cache's capacity
+	c := arc.t1.Len() + arc.t2.Len()
+	for _, ghosts := range []*list.List{arc.b1, arc.b2} {
+		for ghosts.Len() > c {
+			delete(arc.m, ghosts.Remove(ghosts.Back()).(*arcEntry).key)
+		}
+	}
+}
+
+func (arc *arcPolicy) OnDelete(key string) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	if el, ok := arc.m[key]; ok && arc.resident(el) {
+		el.Value.(*arcEntry).ll.Remove(el)
+		delete(arc.m, key)
+	}
+}
+
+// Victims evicts from t1 while it's longer than its target length, else from
+// t2, remembering evicted keys as ghosts.
+func (arc *arcPolicy) Victims(yield func(key string) bool) {
+	arc.Lock()
+	defer arc.Unlock()
+
+	for {
+		var el *list.Element
+
+		if arc.t1.Len() > 0 && (arc.t1.Len() > arc.p || arc.t2.Len() == 0) {
+			el = arc.t1.Back()
+			arc.move(el, arc.b1)
+		} else if arc.t2.Len() > 0 {
+			el = arc.t2.Back()
+			arc.move(el, arc.b2)
+		} else {
+			return
+		}
+
+		if !yield(el.Value.(*arcEntry).key) {
+			return
+		}
+	}
+}
+
+func (arc *arcPolicy) resident(el *list.Element) bool {
+	ll := el.Value.(*arcEntry).ll
+	return ll == arc.t1 || ll == arc.t2
+}
+
+func (arc *arcPolicy) move(el *list.Element, to *list.List) {
+	entry := el.Value.(*arcEntry)
+	entry.ll.Remove(el)
+	entry.ll = to
+	arc.m[entry.key] = to.PushFront(entry)
+}
+
+func arcDelta(a, b int) int {
+	if b == 0 || a/b < 1 {
+		return 1
+	}
+	return a / b
+}
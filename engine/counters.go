@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// counters are updated atomically, without holding the top level lock.
+type counters struct {
+	hits         uint64
+	staleHits    uint64
+	misses       uint64
+	coalesced    uint64
+	negativeHits uint64
+
+	fills      uint64
+	fillErrors uint64
+	rejections uint64
+
+	evictions           uint64
+	irrelevantEvictions uint64
+	expirations         uint64
+	invalidations       uint64
+
+	fillLatency histogram
+}
+
+// fillLatencyBounds are the upper bounds of the fill latency histogram
+// buckets.
+var fillLatencyBounds = [...]time.Duration{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type histogram struct {
+	counts [len(fillLatencyBounds) + 1]uint64 // last one is +Inf
+	sum    int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(fillLatencyBounds) && d > fillLatencyBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	hs := Histogram{
+		Bounds: fillLatencyBounds[:],
+		Counts: make([]uint64, len(h.counts)),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		hs.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		hs.Count += hs.Counts[i]
+	}
+	return hs
+}
+
+// Histogram is a snapshot of a duration histogram.
+type Histogram struct {
+	Bounds []time.Duration // inclusive upper bounds of all buckets but the last
+	Counts []uint64        // per bucket, len(Counts) == len(Bounds)+1
+	Count  uint64          // sum of Counts
+	Sum    time.Duration   // sum of all observations
+}
+
+// Stats is a snapshot of the engine's state, as returned by Engine.Stats.
+// Counters start at zero with NewEngine and never decrease.
+type Stats struct {
+	Keys            int   // number of cached rows, including stale ones
+	StaleKeys       int   // number of expired rows kept around
+	TTLKeys         int   // number of rows with an expiry
+	PayloadBytes    int64 // sum of the length of all cached values
+	MaxPayloadBytes int64 // Options.MaxPayloadTotalBytes
+
+	// Sizes of the access statistics of the default eviction policy, zero
+	// with any other policy.
+	RelevantKeys   int
+	IrrelevantKeys int
+
+	Hits      uint64 // reads served a fresh value
+	StaleHits uint64 // reads served a stale value
+	Misses    uint64 // reads which started a cache fill
+	Coalesced uint64 // reads which joined a running cache fill
+
+	NegativeKeys int    // number of cached origin errors
+	NegativeHits uint64 // number of Gets answered with a cached error
+
+	InFlightFills int    // cache fills currently running
+	Fills         uint64 // cache fills started, in the background too
+	FillErrors    uint64 // cache fills failed, by timing out too
+	FillLatency   Histogram
+	Rejections    uint64 // fetched values not cached, see MaxItemBytes and Admission
+
+	Evictions uint64 // rows deleted to make room for others
+	// IrrelevantEvictions are the Evictions of rows not accessed within the
+	// relevance window, see EvictedIrrelevant.
+	IrrelevantEvictions uint64
+	Expirations         uint64 // rows expired by their TTL
+	Invalidations       uint64 // rows deleted by Invalidate, InvalidatePrefix or InvalidateTag
+
+	DroppedAccesses uint64 // accesses not passed to the eviction policy
+}
+
+// Stats returns a snapshot of the engine's state.
+func (e *Engine) Stats() Stats {
+	e.rwm.RLock()
+	s := Stats{
+		Keys:            len(e.data),
+		StaleKeys:       len(e.stale),
+		TTLKeys:         len(e.ttl.m) - len(e.negative), // errors expire too
+		PayloadBytes:    e.payloadTotal,
+		MaxPayloadBytes: e.maxPayloadTotal,
+		NegativeKeys:    len(e.negative),
+		InFlightFills:   len(e.fillCond),
+	}
+	e.rwm.RUnlock()
+
+	if e.stats != nil {
+		e.stats.Lock()
+		s.RelevantKeys = len(e.stats.relevantMap)
+		s.IrrelevantKeys = len(e.stats.irrelevantMap)
+		e.stats.Unlock()
+	}
+
+	c := e.counters
+	s.Hits = atomic.LoadUint64(&c.hits)
+	s.StaleHits = atomic.LoadUint64(&c.staleHits)
+	s.Misses = atomic.LoadUint64(&c.misses)
+	s.Coalesced = atomic.LoadUint64(&c.coalesced)
+	s.NegativeHits = atomic.LoadUint64(&c.negativeHits)
+	s.Fills = atomic.LoadUint64(&c.fills)
+	s.FillErrors = atomic.LoadUint64(&c.fillErrors)
+	s.FillLatency = c.fillLatency.snapshot()
+	s.Rejections = atomic.LoadUint64(&c.rejections)
+	s.Evictions = atomic.LoadUint64(&c.evictions)
+	s.IrrelevantEvictions = atomic.LoadUint64(&c.irrelevantEvictions)
+	s.Expirations = atomic.LoadUint64(&c.expirations)
+	s.Invalidations = atomic.LoadUint64(&c.invalidations)
+	s.DroppedAccesses = atomic.LoadUint64(&e.accesses.dropped)
+
+	return s
+}
+
+// add sums up the stats of several engines.
+func (s *Stats) add(o Stats) {
+	s.Keys += o.Keys
+	s.StaleKeys += o.StaleKeys
+	s.TTLKeys += o.TTLKeys
+	s.PayloadBytes += o.PayloadBytes
+	s.MaxPayloadBytes += o.MaxPayloadBytes
+	s.RelevantKeys += o.RelevantKeys
+	s.IrrelevantKeys += o.IrrelevantKeys
+	s.Hits += o.Hits
+	s.StaleHits += o.StaleHits
+	s.Misses += o.Misses
+	s.Coalesced += o.Coalesced
+	s.NegativeKeys += o.NegativeKeys
+	s.NegativeHits += o.NegativeHits
+	s.InFlightFills += o.InFlightFills
+	s.Fills += o.Fills
+	s.FillErrors += o.FillErrors
+	s.Rejections += o.Rejections
+	s.Evictions += o.Evictions
+	s.IrrelevantEvictions += o.IrrelevantEvictions
+	s.Expirations += o.Expirations
+	s.Invalidations += o.Invalidations
+	s.DroppedAccesses += o.DroppedAccesses
+
+	if s.FillLatency.Counts == nil {
+		s.FillLatency.Bounds = o.FillLatency.Bounds
+		s.FillLatency.Counts = make([]uint64, len(o.FillLatency.Counts))
+	}
+	for i, c := range o.FillLatency.Counts {
+		s.FillLatency.Counts[i] += c
+	}
+	s.FillLatency.Count += o.FillLatency.Count
+	s.FillLatency.Sum += o.FillLatency.Sum
+}
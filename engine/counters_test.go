@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+
+	e, err := NewEngine(&testOptionsDefault)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	// 1 miss, 4 coalesced waiters
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Get("a")
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	e.Get("a")
+	e.Get("error")
+
+	exp := time.Now().Add(20 * time.Millisecond)
+	assert.Nil(t, e.Set("b", []byte("b"), &exp))
+	e.Invalidate("a", "nope")
+	time.Sleep(300 * time.Millisecond) // TTLTickStep
+
+	s := e.Stats()
+	assert.Equal(t, uint64(1), s.Hits)
+	assert.Equal(t, uint64(2), s.Misses)
+	assert.Equal(t, uint64(4), s.Coalesced)
+	assert.Equal(t, uint64(2), s.Fills)
+	assert.Equal(t, uint64(1), s.FillErrors)
+	assert.Equal(t, uint64(1), s.Invalidations)
+	assert.Equal(t, uint64(1), s.Expirations)
+	assert.Equal(t, uint64(0), s.Evictions)
+	assert.Equal(t, 0, s.Keys)
+	assert.Equal(t, 0, s.InFlightFills)
+	assert.Equal(t, testOptionsDefault.MaxPayloadTotalBytes, s.MaxPayloadBytes)
+
+	h := s.FillLatency
+	assert.Equal(t, uint64(2), h.Count)
+	assert.Equal(t, len(h.Bounds)+1, len(h.Counts))
+	assert.True(t, h.Sum >= 200*time.Millisecond)
+	for i, b := range h.Bounds {
+		if b < 100*time.Millisecond { // both fills took 100ms
+			assert.Equal(t, uint64(0), h.Counts[i])
+		}
+	}
+}
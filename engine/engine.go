@@ -2,10 +2,12 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
-	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	boom "github.com/tylertreat/BoomFilters"
@@ -13,109 +15,315 @@ import (
 	"github.com/wv0m56/fury/datastructure/linkedlist"
 )
 
+var (
+	// ErrClosed is returned by Engine methods called after Close.
+	ErrClosed = errors.New("engine closed")
+
+	// ErrTooLarge is returned by Set when a value is larger than
+	// MaxItemBytes.
+	ErrTooLarge = errors.New("value larger than MaxItemBytes")
+)
+
 type Engine struct {
 	rwm             *sync.RWMutex
 	data            map[string][]byte
 	fillCond        map[string]*condition
 	ttl             *ttlControl
-	stats           *accessStats
+	stats           *accessStats // nil unless it's the eviction policy
+	policy          EvictionPolicy
+	accesses        *accessBuffer // for policy
 	o               Origin
 	timeout         time.Duration
 	payloadTotal    int64
 	maxPayloadTotal int64
+	maxItem         int64
+	admission       bool
+
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	stale                map[string]*staleRow
+	grace                map[string]staleness // per key grace periods
+	validators           map[string]string
+	tags                 map[string]map[string]struct{} // tag -> keys
+	keyTags              map[string][]string
+	subscriptions        []*Subscription
+	bus                  InvalidationBus
+	unsubscribeBus       func()
+
+	negativeTTLNotFound time.Duration
+	negativeTTLError    time.Duration
+	negative            map[string]error // cached origin errors
+
+	counters *counters
+
+	ctx    context.Context // parent of all cache fills, cancelled by Close
+	cancel context.CancelFunc
+	done   chan struct{} // closed by Close to stop the loops
+	loops  sync.WaitGroup
+	fills  sync.WaitGroup
+	closed bool
 }
 
 // NewEngine creates a new cache engine with a skiplist as the underlying data
 // structure.
 func NewEngine(opts *Options) (*Engine, error) {
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	return newEngine(opts), nil
+}
 
-	{ // sanity checks
+// checkOptions is the sanity check of the options of an Engine as a whole.
+func checkOptions(opts *Options) error {
 
-		if opts.ExpectedLen < 1024 {
-			return nil, errors.New("ExpectedLen must be >= 1024")
-		}
+	if opts.ExpectedLen < 1024 {
+		return errors.New("ExpectedLen must be >= 1024")
+	}
 
-		if opts.MaxPayloadTotalBytes < 10*1000*1000 {
-			return nil, errors.New("MaxPayloadTotalSize must be >= 10*1000*1000 bytes")
-		}
+	if opts.MaxPayloadTotalBytes < 10*1000*1000 {
+		return errors.New("MaxPayloadTotalSize must be >= 10*1000*1000 bytes")
+	}
 
-		if opts.CacheFillTimeout < 10*time.Millisecond {
-			return nil, errors.New("cachefill timeout too small")
-		}
+	if opts.TTLIndex < SkiplistTTL || opts.TTLIndex > TimingWheelTTL {
+		return errors.New("unknown TTLIndex")
+	}
 
-		if opts.TTLTickStep < 1*time.Millisecond {
-			return nil, errors.New("TTL tick step too small")
-		}
+	if opts.CacheFillTimeout < 10*time.Millisecond {
+		return errors.New("cachefill timeout too small")
+	}
 
-		if opts.AccessStatsTickStep < 1*time.Millisecond ||
-			opts.AccessStatsTickStep > opts.AccessStatsRelevanceWindow {
+	if opts.TTLTickStep < 1*time.Millisecond {
+		return errors.New("TTL tick step too small")
+	}
 
-			return nil, errors.New("access stats tick step too small or bigger than relevance window")
-		}
+	if opts.AccessStatsTickStep < 1*time.Millisecond ||
+		opts.AccessStatsTickStep > opts.AccessStatsRelevanceWindow {
 
-		if opts.AccessStatsRelevanceWindow < 100*time.Millisecond {
-			return nil, errors.New("access stats relevance window too small")
-		}
+		return errors.New("access stats tick step too small or bigger than relevance window")
 	}
 
-	// log2(ExpectedLen)-1
-	n := int(math.Floor(math.Log2(float64(opts.ExpectedLen / 2))))
+	if opts.AccessStatsRelevanceWindow < 100*time.Millisecond {
+		return errors.New("access stats relevance window too small")
+	}
+
+	if opts.StaleWhileRevalidate < 0 || opts.StaleIfError < 0 {
+		return errors.New("stale durations must not be negative")
+	}
+
+	if opts.NegativeTTLNotFound < 0 || opts.NegativeTTLError < 0 {
+		return errors.New("negative TTLs must not be negative")
+	}
+
+	if opts.MaxItemBytes < 0 || opts.MaxItemBytes > opts.MaxPayloadTotalBytes {
+		return errors.New("MaxItemBytes must be between 0 and MaxPayloadTotalBytes")
+	}
+
+	if opts.Admission && (opts.EvictionPolicy != nil || opts.NewEvictionPolicy != nil) {
+		return errors.New("Admission requires the default eviction policy")
+	}
+
+	if opts.AccessBufferSize < 0 {
+		return errors.New("access buffer size must not be negative")
+	}
+
+	return nil
+}
+
+func newEngine(opts *Options) *Engine {
+
+	n := skiplistHeight(opts.ExpectedLen)
+
+	maxItem := opts.MaxItemBytes
+	if maxItem == 0 {
+		maxItem = opts.MaxPayloadTotalBytes
+	}
 
 	e := &Engine{
-		&sync.RWMutex{},
-		make(map[string][]byte),
-		make(map[string]*condition),
-		&ttlControl{
-			*(duplist.NewTimeString(n)),
-			make(map[string]*duplist.TimeStringElement),
+		rwm:      &sync.RWMutex{},
+		data:     make(map[string][]byte),
+		fillCond: make(map[string]*condition),
+		ttl: &ttlControl{
+			newTTLIndex(opts.TTLIndex, n, skiplistSource(opts.SkiplistSeed, 0),
+				opts.TTLTickStep),
+			make(map[string]ttlEntry),
 			nil,
 		},
-		&accessStats{
+		o:               opts.O,
+		timeout:         opts.CacheFillTimeout,
+		maxPayloadTotal: opts.MaxPayloadTotalBytes,
+		maxItem:         maxItem,
+		admission:       opts.Admission,
+
+		staleWhileRevalidate: opts.StaleWhileRevalidate,
+		staleIfError:         opts.StaleIfError,
+		stale:                make(map[string]*staleRow),
+		grace:                make(map[string]staleness),
+		validators:           make(map[string]string),
+		tags:                 make(map[string]map[string]struct{}),
+		keyTags:              make(map[string][]string),
+
+		negativeTTLNotFound: opts.NegativeTTLNotFound,
+		negativeTTLError:    opts.NegativeTTLError,
+		negative:            make(map[string]error),
+
+		counters: &counters{},
+
+		bus: opts.InvalidationBus,
+
+		done: make(chan struct{}),
+	}
+
+	e.ttl.e = e
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	if e.policy = opts.EvictionPolicy; e.policy == nil && opts.NewEvictionPolicy != nil {
+		e.policy = opts.NewEvictionPolicy(opts.ExpectedLen)
+	}
+	if e.policy == nil {
+		e.stats = &accessStats{
 			sync.Mutex{},
 			boom.NewCountMinSketch(0.001, 0.99),
 			&linkedlist.TimeString{},
-			duplist.NewUint64String(n),
+			duplist.NewUint64StringWithSource(n, skiplistSource(opts.SkiplistSeed, 1)),
 			make(map[string]relevantTuple),
 			opts.AccessStatsRelevanceWindow,
-			duplist.NewUint64String(n - 1),
+			duplist.NewUint64StringWithSource(n-1, skiplistSource(opts.SkiplistSeed, 2)),
 			make(map[string]*duplist.Uint64StringElement),
-		},
-		opts.O,
-		opts.CacheFillTimeout,
-		0,
-		opts.MaxPayloadTotalBytes,
+		}
+		e.policy = e.stats
 	}
 
-	e.ttl.e = e
+	bufferSize := opts.AccessBufferSize
+	if bufferSize == 0 {
+		bufferSize = 16
+	}
+	e.accesses = newAccessBuffer(bufferSize, opts.AccessOverflow, e.done)
 
-	go e.ttl.startLoop(opts.TTLTickStep)
-	go e.stats.startLoop(opts.AccessStatsTickStep)
+	e.loops.Add(1)
+	go func() {
+		defer e.loops.Done()
+		e.ttl.startLoop(opts.TTLTickStep, e.done)
+	}()
 
-	return e, nil
+	e.loops.Add(1)
+	if e.stats != nil {
+		go func() {
+			defer e.loops.Done()
+			e.stats.startLoop(opts.AccessStatsTickStep, e.done, e.accesses)
+		}()
+	} else {
+		go func() {
+			defer e.loops.Done()
+			e.accesses.loop(opts.AccessStatsTickStep, e.done, func(keys []string) {
+				for _, k := range keys {
+					e.policy.OnAccess(k)
+				}
+			})
+		}()
+	}
+
+	if e.bus != nil {
+		e.unsubscribeBus = e.bus.Subscribe(e.apply)
+	}
+
+	return e
+}
+
+// skiplistSource returns the source of the i-th skiplist of an engine, nil
+// (seeded with the current time) if seed is zero.
+func skiplistSource(seed, i int64) rand.Source {
+	if seed == 0 {
+		return nil
+	}
+	return rand.NewSource(seed + i)
+}
+
+// Close stops the engine's background loops and waits for in-flight cache
+// fills to finish. If ctx is done first, the remaining fills are cancelled and
+// ctx.Err() is returned. Gets which are still waiting on a cancelled fill, as
+// well as all Gets and Sets called after Close, return ErrClosed.
+// Close releases the cached data and returns ErrClosed if called more than
+// once.
+func (e *Engine) Close(ctx context.Context) (err error) {
+	e.rwm.Lock()
+	if e.closed {
+		e.rwm.Unlock()
+		return ErrClosed
+	}
+	e.closed = true
+	e.rwm.Unlock()
+
+	if e.unsubscribeBus != nil {
+		e.unsubscribeBus()
+	}
+
+	close(e.done)
+	e.loops.Wait()
+
+	filled := make(chan struct{})
+	go func() {
+		e.fills.Wait()
+		close(filled)
+	}()
+
+	select {
+	case <-filled:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	e.cancel()
+
+	e.rwm.Lock()
+	e.data = nil
+	e.payloadTotal = 0
+	subscriptions := e.subscriptions
+	e.rwm.Unlock()
+
+	for _, s := range subscriptions {
+		s.Unsubscribe()
+	}
+
+	return
 }
 
 type condition struct {
 	sync.Cond
-	count int
-	b     []byte
-	err   error
+	count      int
+	b          []byte
+	err        error
+	cancel     context.CancelFunc
+	background bool // not abandoned when count drops to 0
+	sb         *streamBuffer
 }
 
 func (e *Engine) Get(key string) (r *bytes.Reader, err error) {
-	return e.get(key)
+	return e.get(context.Background(), key)
 }
 
-func (e *Engine) get(key string) (*bytes.Reader, error) {
+// GetContext is like Get, except that it gives up waiting on a cache fill and
+// returns ctx.Err() as soon as ctx is done. Concurrent callers of the same
+// key still share one fill, which is only abandoned once every one of them
+// has given up. The values of the context which triggered the fill are
+// visible to Origin implementations implementing ContextOrigin.
+func (e *Engine) GetContext(ctx context.Context, key string) (r *bytes.Reader, err error) {
+	return e.get(ctx, key)
+}
 
-	go e.stats.addToWindow(key)
+func (e *Engine) get(ctx context.Context, key string) (*bytes.Reader, error) {
 
-	r := e.tryget(key)
-	if r != nil { // cache hit
-		return r, nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.accesses.record(key)
+
+	r, err := e.lookup(key)
+	if r != nil || err != nil { // cache hit
+		return r, err
 	}
 
 	// cache miss
-	r, err := e.cacheFill(key)
+	r, err = e.cacheFill(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -123,208 +331,496 @@ func (e *Engine) get(key string) (*bytes.Reader, error) {
 }
 
 func (e *Engine) tryget(key string) *bytes.Reader {
+	r, _ := e.lookup(key)
+	return r
+}
+
+// lookup returns either the fresh value of key, or the cached error of a
+// previous cache fill.
+func (e *Engine) lookup(key string) (*bytes.Reader, error) {
 	e.rwm.RLock()
 	defer e.rwm.RUnlock()
 
+	return e.lookupLocked(key)
+}
+
+// still holding top level (read) lock
+func (e *Engine) lookupLocked(key string) (*bytes.Reader, error) {
+
 	if b, ok := e.data[key]; ok {
-		return bytes.NewReader(b)
+		if _, stale := e.stale[key]; !stale {
+			atomic.AddUint64(&e.counters.hits, 1)
+			return bytes.NewReader(b), nil
+		}
 	}
 
-	return nil
+	if err, ok := e.negative[key]; ok {
+		atomic.AddUint64(&e.counters.negativeHits, 1)
+		return nil, err
+	}
+
+	return nil, nil
 }
 
-func (e *Engine) cacheFill(key string) (*bytes.Reader, error) {
+func (e *Engine) cacheFill(ctx context.Context, key string) (*bytes.Reader, error) {
 
 	e.rwm.Lock()
-	if b, ok := e.data[key]; ok {
+	b, c, err := e.acquire(ctx, key, e.startFill)
+	if c == nil {
 		e.rwm.Unlock()
+		if err != nil {
+			return nil, err
+		}
 		return bytes.NewReader(b), nil
 	}
 
-	// still locked
+	return e.blockUntilFilled(ctx, key, c)
+}
+
+// acquire returns either the value of key which may be served, or the cache
+// fill of key (started by start if need be) with one more waiter counted.
+// still holding top level lock
+func (e *Engine) acquire(ctx context.Context, key string, start fillStarter) (
+	[]byte, *condition, error) {
+
+	if e.closed {
+		return nil, nil, ErrClosed
+	}
+
+	if b, ok := e.data[key]; ok {
+
+		sr, stale := e.stale[key]
+		if !stale {
+			atomic.AddUint64(&e.counters.hits, 1)
+			return b, nil, nil
+		}
+
+		if sr.servable(time.Now()) {
+			if _, ok := e.fillCond[key]; !ok {
+				start(ctx, key, 0)
+			}
+			atomic.AddUint64(&e.counters.staleHits, 1)
+			return b, nil, nil
+		}
+	}
+
 	if cond, ok := e.fillCond[key]; ok && cond != nil {
 
 		cond.count++
-		return e.blockUntilFilled(key)
+		atomic.AddUint64(&e.counters.coalesced, 1)
+		return nil, cond, nil
 
 	} else {
 
-		e.fillCond[key] = &condition{*sync.NewCond(e.rwm), 1, nil, nil}
-		go e.firstFill(key)
-		return e.blockUntilFilled(key)
+		atomic.AddUint64(&e.counters.misses, 1)
+		return nil, start(ctx, key, 1), nil
+	}
+}
+
+// release drops one waiter of c, abandoning the fill once nobody waits for it
+// anymore.
+// still holding top level lock
+func (e *Engine) release(key string, c *condition) {
+	c.count--
+	if c.count == 0 && !c.background {
+		if e.fillCond[key] == c {
+			delete(e.fillCond, key)
+		}
+		c.cancel() // nobody is interested in an unfinished fill anymore
 	}
 }
 
-func (e *Engine) firstFill(key string) {
+// fillStarter launches a cache fill of key on behalf of count waiters. A fill
+// without waiters runs in the background until it's done.
+// still holding top level lock
+type fillStarter func(ctx context.Context, key string, count int) *condition
+
+// startFill is the fillStarter fetching key on its own.
+func (e *Engine) startFill(ctx context.Context, key string, count int) *condition {
+
+	if v, ok := e.validators[key]; ok {
+		ctx = context.WithValue(ctx, validatorKey{}, v)
+	}
+
+	fillCtx, cancel := context.WithTimeout(e.ctx, e.timeout)
+	c := &condition{*sync.NewCond(e.rwm), count, nil, nil, cancel, count == 0,
+		newStreamBuffer()}
+	e.fillCond[key] = c
+	e.fills.Add(1)
+	atomic.AddUint64(&e.counters.fills, 1)
+	go e.firstFill(fillContext{fillCtx, ctx}, key, c)
+
+	return c
+}
+
+// fillContext is done when the cache fill times out or is abandoned by all of
+// its waiters, but looks up values in the context of the caller which
+// triggered the fill.
+type fillContext struct {
+	context.Context
+	vals context.Context
+}
+
+func (fc fillContext) Value(key interface{}) interface{} {
+	return fc.vals.Value(key)
+}
+
+func (e *Engine) firstFill(ctx context.Context, key string, c *condition) {
+	start := time.Now()
+
+	rc, exp, err := e.fetch(ctx, key)
+	_, conditional := ValidatorFromContext(ctx)
+
+	if !e.completeFill(key, c, start, rc, exp, err, conditional) {
+		// evicted in the meantime, fetch the whole value after all
+		rc, exp, err = e.fetch(context.WithValue(ctx, validatorKey{}, nil), key)
+		e.completeFill(key, c, start, rc, exp, err, false)
+	}
+}
+
+// completeFill reads the value of key fetched by a cache fill started at
+// start, caches it and hands it to the waiters of c.
+// If the fetch was conditional and answered with ErrNotModified but the value
+// was evicted in the meantime, completeFill leaves c alone and returns false.
+func (e *Engine) completeFill(key string, c *condition, start time.Time,
+	rc io.ReadCloser, exp *time.Time, err error, conditional bool) bool {
+
 	var (
-		err error
-		rw  *rowWriter
-		rc  io.ReadCloser
-		exp *time.Time
+		rw     *rowWriter
+		locked bool
 	)
 
-	defer func() {
-		if err != nil {
-
+	if conditional && errors.Is(err, ErrNotModified) {
+		e.rwm.Lock()
+		if _, ok := e.data[key]; !ok && c.b == nil && !e.closed {
+			e.rwm.Unlock()
 			if rc != nil {
 				_ = rc.Close()
 			}
-			e.rwm.Lock()
-			e.fillCond[key].err = err
+			return false
+		}
+		locked = true // until revalidated, lest it be evicted again
+	}
 
-		} else {
+	defer func() {
+		defer e.fills.Done()
+		e.counters.fillLatency.observe(time.Since(start))
 
+		if rc != nil {
+			_ = rc.Close()
+		}
+
+		if err == nil && rc == nil {
+			err = errors.New("nil ReadCloser from Fetch")
+		}
+
+		if !locked {
 			e.rwm.Lock()
+		}
 
-			if rw.b != nil {
+		if c.b != nil {
+			// already satisfied by Set, which is fresher than the origin
 
-				if rowPayloadSize := rw.b.Len(); rowPayloadSize != 0 &&
-					e.payloadTotal+int64(rowPayloadSize) > e.maxPayloadTotal {
+		} else if b, ok := e.data[key]; ok && errors.Is(err, ErrNotModified) {
 
-					if twiceSpace := 2 * int64(rowPayloadSize); int64(twiceSpace) > e.maxPayloadTotal {
-						e.evictUntilFree(e.maxPayloadTotal)
-					} else {
-						e.evictUntilFree(twiceSpace)
-					}
-				}
+			err = nil
+			e.revalidate(key, exp)
+			c.b = b
+			c.sb.Write(b)
 
-				if exp != nil && exp.After(time.Now()) {
-					rw.commit()
-					e.setExpiry(key, *exp)
-				} else if exp == nil {
-					rw.commit()
-				}
+		} else if err != nil {
 
-				e.payloadTotal += int64(rw.b.Len())
+			if e.closed {
+				err = ErrClosed
 			}
+			c.err = err
+			atomic.AddUint64(&e.counters.fillErrors, 1)
 
-			if rw.b != nil && rw.b.Bytes() != nil {
-				e.fillCond[key].b = rw.b.Bytes()
+			if sr, ok := e.stale[key]; ok {
+				sr.refreshFailed = true
 			} else {
-				e.fillCond[key].b = []byte{} // terminates cond.Wait() loop
+				e.cacheNegative(key, err)
 			}
 
+		} else {
+
+			b := rw.bytes() // never nil, terminates cond.Wait() loop
+			if rw.written() && !e.closed && rw.commit(b, exp) {
+				body := unwrapBody(rc)
+				if st, ok := body.(Staler); ok {
+					e.grace[key] = stalenessOf(st)
+				}
+				if v, ok := body.(Validator); ok {
+					e.validators[key] = v.Validator()
+				}
+				if t, ok := body.(Tagger); ok {
+					e.tag(key, t.Tags())
+				}
+			}
+
+			c.b = b
 		}
 
-		e.fillCond[key].Broadcast()
+		c.sb.finish(err)
+		c.Broadcast()
+		if e.fillCond[key] == c { // finished fills are not to be joined
+			delete(e.fillCond, key)
+		}
 		e.rwm.Unlock()
+		c.cancel()
 	}()
 
-	// fetch from remote and fill up buffer
-	rc, exp, err = e.o.Fetch(key, e.timeout)
-	if err != nil {
-		return
-	}
-	rw = &rowWriter{key, nil, e}
-
-	if rc != nil {
-		_, err = io.Copy(rw, rc)
-	} else {
-		err = errors.New("nil ReadCloser from Fetch")
+	if err != nil || rc == nil {
+		return true
 	}
-
-	return
+	rw = &rowWriter{key, c.sb, e}
+	_, err = io.Copy(rw, rc)
+	return true
 }
 
-func (e *Engine) blockUntilFilled(key string) (r *bytes.Reader, err error) {
+// fetch calls FetchContext if the origin implements ContextOrigin, else Fetch
+// with whatever is left until ctx's deadline as timeout.
+func (e *Engine) fetch(ctx context.Context, key string) (io.ReadCloser, *time.Time, error) {
+	if co, ok := e.o.(ContextOrigin); ok {
+		return co.FetchContext(ctx, key)
+	}
 
-	c := e.fillCond[key]
-	for c.b == nil && c.err == nil {
-		e.fillCond[key].Wait()
+	timeout := e.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
 	}
+	return e.o.Fetch(key, timeout)
+}
 
-	if c.err != nil {
-		err = c.err
+// Must be called with top level lock held, releases it before returning.
+func (e *Engine) blockUntilFilled(ctx context.Context, key string, c *condition) (
+	r *bytes.Reader, err error) {
+
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-done: // wake up the Wait() loop below
+				e.rwm.Lock()
+				c.Broadcast()
+				e.rwm.Unlock()
+			case <-stop:
+			}
+		}()
 	}
 
-	if b := c.b; b != nil {
-		r = bytes.NewReader(e.fillCond[key].b)
+	for c.b == nil && c.err == nil && ctx.Err() == nil {
+		c.Wait()
 	}
 
-	e.fillCond[key].count--
-	if e.fillCond[key].count == 0 {
-		delete(e.fillCond, key)
+	if c.err != nil {
+		if b, ok := e.staleFallback(key); ok {
+			r = bytes.NewReader(b)
+		} else {
+			err = c.err
+		}
+	} else if c.b != nil {
+		r = bytes.NewReader(c.b)
+	} else {
+		err = ctx.Err()
 	}
 
+	e.release(key, c)
 	e.rwm.Unlock()
 
 	return
 }
 
+// commit stores b as the value of key, replacing any previous value, evicting
+// other rows if the payload total would grow past its maximum. An expired b is
+// not stored at all, in which case commit returns false.
 // still holding top level lock throughout
-func (e *Engine) evictUntilFree(wantedFreeSpace int64) {
-	if wantedFreeSpace > e.maxPayloadTotal {
-		panic("cache-fill candidate is larger than allowed total") // reconsider
+func (e *Engine) commit(key string, b []byte, exp *time.Time) bool {
+	if exp != nil && !exp.After(time.Now()) {
+		return false
 	}
 
-	var enoughFreed bool
-	e.stats.Lock()
-	defer e.stats.Unlock()
+	e.delData(key, Replaced)
 
-	for it := e.stats.irrelevantDuplist.First(); it != nil; it = it.Next() {
+	if rowPayloadSize := int64(len(b)); rowPayloadSize != 0 &&
+		e.payloadTotal+rowPayloadSize > e.maxPayloadTotal {
 
-		e.delDataTTLStats(it.Val())
-		if freeSpace := e.maxPayloadTotal - e.payloadTotal; freeSpace > wantedFreeSpace {
-			enoughFreed = true
-			break
+		if twiceSpace := 2 * rowPayloadSize; twiceSpace > e.maxPayloadTotal {
+			e.evictUntilFree(e.maxPayloadTotal)
+		} else {
+			e.evictUntilFree(twiceSpace)
 		}
 	}
 
-	if !enoughFreed {
-		for it := e.stats.relevantDuplist.First(); it != nil; it = it.Next() {
+	e.data[key] = b
+	e.payloadTotal += int64(len(b))
+	e.policy.OnInsert(key, len(b))
+
+	if exp != nil {
+		e.setExpiry(key, *exp)
+	} else {
+		e.ttl.delTTLEntry(key)
+	}
+
+	return true
+}
+
+// still holding top level lock throughout
+func (e *Engine) evictUntilFree(wantedFreeSpace int64) {
 
-			e.delDataTTLStats(it.Val())
+	as, _ := e.policy.(*accessStats)
 
-			if freeSpace := e.maxPayloadTotal - e.payloadTotal; freeSpace > wantedFreeSpace {
-				break
+	var victims []string
+	e.policy.Victims(func(key string) bool {
+
+		reason := EvictedRelevant
+		if as != nil && !as.relevantLocked(key) {
+			reason = EvictedIrrelevant
+		}
+
+		// only rows holding a value count as evicted, the policy may know of
+		// keys whose accesses were recorded after their deletion
+		if _, ok := e.data[key]; ok {
+			atomic.AddUint64(&e.counters.evictions, 1)
+			if reason == EvictedIrrelevant {
+				atomic.AddUint64(&e.counters.irrelevantEvictions, 1)
 			}
 		}
+
+		e.delData(key, reason)
+		e.ttl.delTTLEntry(key)
+		victims = append(victims, key)
+
+		freeSpace := e.maxPayloadTotal - e.payloadTotal
+		return freeSpace <= wantedFreeSpace
+	})
+
+	for _, key := range victims {
+		e.policy.OnDelete(key)
 	}
 }
 
-func (e *Engine) delData(key string) {
+// delData deletes key and everything kept along with its value, reporting the
+// deletion of a value to subscribers as caused by reason.
+func (e *Engine) delData(key string, reason EventReason) {
 	if b, ok := e.data[key]; ok {
 		e.payloadTotal -= int64(len(b))
 		delete(e.data, key)
+		if len(e.subscriptions) > 0 {
+			e.emit(Event{key, reason, len(b)})
+		}
 	}
+	delete(e.stale, key)
+	delete(e.grace, key)
+	delete(e.validators, key)
+	delete(e.negative, key)
+	e.untag(key)
 }
 
-func (e *Engine) delDataTTLStats(key string) {
-	e.delData(key)
+func (e *Engine) delDataTTLStats(key string, reason EventReason) {
+	e.delData(key, reason)
 	e.ttl.delTTLEntry(key)
-	go e.stats.updateDataDeletion(key)
+	e.policy.OnDelete(key)
 }
 
 type rowWriter struct {
 	key string
-	b   *bytes.Buffer
+	sb  *streamBuffer
 	e   *Engine
 }
 
 func (rw *rowWriter) Write(p []byte) (n int, err error) {
-	if rw.b == nil {
-		rw.b = bytes.NewBuffer(nil)
+	return rw.sb.Write(p)
+}
+
+func (rw *rowWriter) written() bool {
+	return rw != nil && rw.sb.bytes() != nil
+}
+
+// bytes returns a copy of what was written, sized to fit rather than holding
+// on to the spare capacity of the stream buffer.
+func (rw *rowWriter) bytes() []byte {
+	if !rw.written() {
+		return []byte{}
 	}
-	return rw.b.Write(p)
+	buf := rw.sb.bytes()
+	b := make([]byte, len(buf))
+	copy(b, buf)
+	return b
 }
 
-// no locking.
-func (rw *rowWriter) commit() {
-	if rw.b != nil {
-		rw.e.data[rw.key] = rw.b.Bytes()
-	} else {
-		rw.e.data[rw.key] = []byte{}
+// commit caches the fetched value, unless it's larger than MaxItemBytes or
+// isn't admitted.
+// still holding top level lock
+func (rw *rowWriter) commit(b []byte, exp *time.Time) bool {
+	if int64(len(b)) > rw.e.maxItem || !rw.e.admit(rw.key, int64(len(b))) {
+		atomic.AddUint64(&rw.e.counters.rejections, 1)
+		return false
+	}
+	return rw.e.commit(rw.key, b, exp)
+}
+
+// Set stores value under key without a round trip to the origin, replacing
+// whatever key held before. A nil expiry means value never expires. Gets
+// currently waiting on a cache fill of key are handed value right away, as are
+// GetStream readers which haven't received any of the origin's value yet.
+// value is copied and may be modified by the caller once Set returns.
+func (e *Engine) Set(key string, value []byte, expiry *time.Time) error {
+	b := make([]byte, len(value))
+	copy(b, value)
+	return e.set(key, b, expiry)
+}
+
+// SetReader is like Set, except that the value is read from r until EOF.
+func (e *Engine) SetReader(key string, r io.Reader, expiry *time.Time) error {
+	buf := bytes.NewBuffer(nil)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	return e.set(key, buf.Bytes(), expiry)
+}
+
+func (e *Engine) set(key string, b []byte, expiry *time.Time) error {
+	if int64(len(b)) > e.maxItem {
+		return ErrTooLarge
 	}
+
+	e.rwm.Lock()
+	defer e.rwm.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+
+	e.commit(key, b, expiry)
+
+	if c, ok := e.fillCond[key]; ok && c.b == nil && c.err == nil {
+		c.b = b
+		c.Broadcast()
+
+		// the origin's answer is of no use anymore, unless GetStream readers
+		// are already part way through it
+		if c.sb.resolve(b) {
+			c.cancel()
+		}
+	}
+
+	return nil
 }
 
-// Invalidate deletes keys from the data, TTL, and access stats.
+// Invalidate deletes keys from the data, TTL, and access stats, and
+// publishes them on Options.InvalidationBus.
 // Only invoke Invalidate for manual cluster control (e.g. global purge).
 // Normally, control the invalidation process by setting sensible TTL
 // values at origin.
 func (e *Engine) Invalidate(keys ...string) {
 	e.rwm.Lock()
 	for _, v := range keys {
-		e.delDataTTLStats(v)
+		e.invalidate(v)
 	}
 	e.rwm.Unlock()
+
+	e.publish(Invalidation{Keys: keys})
 }
@@ -2,8 +2,10 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"runtime"
 	"strconv"
 	"sync"
 	"testing"
@@ -312,3 +314,171 @@ func BenchmarkEviction(b *testing.B) {
 		e.evictUntilFree(99 * 1000 * 1000) // 99M
 	}
 }
+
+func TestGetContext(t *testing.T) {
+
+	e, err := NewEngine(&testOptionsDefault) // origin has 100 ms delay
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	// a waiter giving up does not abandon the fill shared with other waiters
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r, err := e.Get("shared")
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "shared", string(b))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	r, err := e.GetContext(ctx, "shared")
+	assert.Nil(t, r)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 90*time.Millisecond)
+	wg.Wait()
+
+	r, err = e.GetContext(ctx, "shared") // done context
+	assert.Nil(t, r)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// values flow down to the origin, abandoned fills get cancelled
+	opts := testOptionsDefault
+	co := &testdummies.ContextOrigin{Abandoned: make(chan string, 1)}
+	opts.O = co
+	e, err = NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	r, err = e.GetContext(
+		context.WithValue(context.Background(), testdummies.ValueKey, "traced"), "k")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "traced", string(b))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = e.GetContext(ctx, "abandoned")
+	assert.Equal(t, context.Canceled, err)
+
+	select {
+	case key := <-co.Abandoned:
+		assert.Equal(t, "abandoned", key)
+	case <-time.After(opts.CacheFillTimeout / 2):
+		t.Error("fill was not cancelled after its only waiter gave up")
+	}
+
+	e.rwm.RLock()
+	assert.Equal(t, 0, len(e.fillCond))
+	e.rwm.RUnlock()
+}
+
+func TestClose(t *testing.T) {
+
+	before := runtime.NumGoroutine()
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.ContextOrigin{} // blocks until cancelled
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+
+	_, err = e.GetContext(
+		context.WithValue(context.Background(), testdummies.ValueKey, "a"), "a")
+	assert.Nil(t, err)
+
+	// fill is cancelled once Close gives up waiting for it
+	waiterErr := make(chan error)
+	go func() {
+		_, err := e.Get("b")
+		waiterErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, e.Close(ctx))
+	assert.Equal(t, ErrClosed, <-waiterErr)
+
+	r, err := e.Get("a")
+	assert.Nil(t, r)
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, e.Close(context.Background()))
+
+	e.rwm.RLock()
+	assert.Nil(t, e.data)
+	e.rwm.RUnlock()
+
+	// in-flight fills are waited for
+	e, err = NewEngine(&testOptionsDefault) // origin has 100 ms delay
+	assert.Nil(t, err)
+	go func() {
+		_, err := e.Get("c")
+		waiterErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, e.Close(context.Background()))
+	assert.Nil(t, <-waiterErr)
+
+	time.Sleep(10 * time.Millisecond) // let stray goroutines return
+	assert.True(t, runtime.NumGoroutine() <= before,
+		"no goroutine must outlive a closed engine")
+}
+
+func TestSet(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.ContextOrigin{} // blocks until cancelled
+	opts.TTLTickStep = 1 * time.Millisecond
+	opts.MaxPayloadTotalBytes = 10 * 1000 * 1000
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	v := []byte("value")
+	assert.Nil(t, e.Set("k", v, nil))
+	v[0] = 'X' // Set made a copy
+	r, err := e.Get("k")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "value", string(b))
+
+	// replacing gives back the space of the old value
+	assert.Nil(t, e.SetReader("k", bytes.NewReader([]byte("vv")), nil))
+	e.rwm.RLock()
+	assert.Equal(t, int64(2), e.payloadTotal)
+	e.rwm.RUnlock()
+
+	exp := time.Now().Add(10 * time.Millisecond)
+	assert.Nil(t, e.Set("expiring", []byte("x"), &exp))
+	assert.True(t, e.GetTTL("expiring")[0] > 0)
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, e.tryget("expiring"))
+
+	// parked waiters get woken up with the value
+	waiter := make(chan string)
+	go func() {
+		r, err := e.Get("parked")
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(r)
+		waiter <- string(b)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, e.Set("parked", []byte("pushed"), nil))
+	assert.Equal(t, "pushed", <-waiter)
+
+	// eviction
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, e.Set(strconv.Itoa(i), make([]byte, 20000), nil))
+	}
+	e.rwm.RLock()
+	assert.True(t, e.payloadTotal <= opts.MaxPayloadTotalBytes)
+	e.rwm.RUnlock()
+
+	assert.Equal(t, ErrTooLarge, e.Set("huge", make([]byte, 10*1000*1000+1), nil))
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventReason is why a cached value was removed.
+type EventReason int
+
+const (
+	// Expired values outlived their TTL, and grace periods if any.
+	Expired EventReason = iota
+
+	// EvictedIrrelevant and EvictedRelevant values were evicted to make room
+	// for others, see Options.AccessStatsRelevanceWindow. Eviction policies
+	// other than the default one only evict EvictedRelevant values.
+	EvictedIrrelevant
+	EvictedRelevant
+
+	// Invalidated values were deleted by Invalidate, InvalidatePrefix or
+	// InvalidateTag.
+	Invalidated
+
+	// Replaced values were overwritten by a cache fill or Set.
+	Replaced
+)
+
+func (r EventReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case EvictedIrrelevant:
+		return "evicted-irrelevant"
+	case EvictedRelevant:
+		return "evicted-relevant"
+	case Invalidated:
+		return "invalidated"
+	case Replaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// Event reports the removal of a cached value.
+type Event struct {
+	Key    string
+	Reason EventReason
+	Size   int // length of the removed value
+}
+
+// Subscription receives the events of an engine on C until Unsubscribe, or
+// until the engine is closed. Events are sent while the engine holds its top
+// level lock, so they're dropped rather than waited for once C is full.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	engines []*Engine
+	dropped uint64 // atomically
+	once    sync.Once
+}
+
+// Subscribe returns a Subscription buffering up to size events.
+func (e *Engine) Subscribe(size int) *Subscription {
+	return subscribe(size, e)
+}
+
+func subscribe(size int, engines ...*Engine) *Subscription {
+	c := make(chan Event, size)
+	s := &Subscription{C: c, c: c, engines: engines}
+
+	closed := false
+	for _, e := range engines {
+		e.rwm.Lock()
+		if e.closed {
+			closed = true
+		} else {
+			e.subscriptions = append(e.subscriptions, s)
+		}
+		e.rwm.Unlock()
+	}
+
+	if closed {
+		s.Unsubscribe()
+	}
+	return s
+}
+
+// Unsubscribe stops and closes C. It's safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		for _, e := range s.engines {
+			e.unsubscribe(s)
+		}
+		close(s.c)
+	})
+}
+
+// Dropped returns the number of events not sent because C was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (e *Engine) unsubscribe(s *Subscription) {
+	e.rwm.Lock()
+	defer e.rwm.Unlock()
+
+	for i, v := range e.subscriptions {
+		if v == s {
+			last := len(e.subscriptions) - 1
+			e.subscriptions[i] = e.subscriptions[last]
+			e.subscriptions[last] = nil
+			e.subscriptions = e.subscriptions[:last]
+			return
+		}
+	}
+}
+
+// still holding top level lock
+func (e *Engine) emit(ev Event) {
+	for _, s := range e.subscriptions {
+		select {
+		case s.c <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
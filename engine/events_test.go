@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = taggedOrigin{}
+	opts.MaxPayloadTotalBytes = 10 * 1000 * 1000
+	opts.AccessStatsRelevanceWindow = 300 * time.Millisecond
+	opts.AccessStatsTickStep = 10 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+
+	sub := e.Subscribe(100)
+	next := func() Event {
+		select {
+		case ev := <-sub.C:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+			return Event{}
+		}
+	}
+
+	assert.Nil(t, e.Set("a", []byte("123"), nil))
+	assert.Nil(t, e.Set("a", []byte("4567"), nil))
+	assert.Equal(t, Event{"a", Replaced, 3}, next())
+
+	e.Get("b#t")
+	assert.Equal(t, 1, e.InvalidateTag("t"))
+	assert.Equal(t, Event{"b#t", Invalidated, 3}, next())
+	e.Invalidate("a", "nothing")
+	assert.Equal(t, Event{"a", Invalidated, 4}, next())
+
+	exp := time.Now().Add(10 * time.Millisecond)
+	assert.Nil(t, e.Set("x", []byte("x"), &exp))
+	assert.Equal(t, Event{"x", Expired, 1}, next())
+
+	big := make([]byte, 4*1000*1000)
+	assert.Nil(t, e.Set("irrelevant", big, nil))
+	assert.Nil(t, e.Set("relevant", big, nil))
+	time.Sleep(2 * opts.AccessStatsRelevanceWindow)
+	e.Get("relevant")
+	e.accesses.drain(e.stats.addBatch)
+
+	before := e.Stats()
+	assert.Nil(t, e.Set("c", big, nil))
+	assert.Equal(t, Event{"irrelevant", EvictedIrrelevant, len(big)}, next())
+	assert.Equal(t, Event{"relevant", EvictedRelevant, len(big)}, next())
+	after := e.Stats()
+	assert.Equal(t, uint64(2), after.Evictions-before.Evictions)
+	assert.Equal(t, uint64(1), after.IrrelevantEvictions-before.IrrelevantEvictions)
+
+	select {
+	case ev := <-sub.C:
+		t.Fatal("unexpected event", ev)
+	default:
+	}
+	assert.Equal(t, uint64(0), sub.Dropped())
+
+	// full subscriptions drop events, closed ones stop receiving them
+	full := e.Subscribe(0)
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	e.Invalidate("c")
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), full.Dropped())
+
+	assert.Nil(t, e.Close(context.Background()))
+	_, ok = <-full.C
+	assert.False(t, ok)
+	_, ok = <-e.Subscribe(1).C
+	assert.False(t, ok)
+}
+
+func TestShardedEvents(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = taggedOrigin{}
+	se, err := NewShardedEngine(&opts, 4)
+	assert.Nil(t, err)
+
+	sub := se.Subscribe(100)
+	keys := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		k := string(rune('a'+i)) + "#all"
+		keys[k] = true
+		se.Get(k)
+	}
+	assert.Equal(t, 20, se.InvalidateTag("all"))
+
+	for i := 0; i < 20; i++ {
+		ev := <-sub.C
+		assert.True(t, keys[ev.Key])
+		assert.Equal(t, Invalidated, ev.Reason)
+		delete(keys, ev.Key)
+	}
+
+	assert.Nil(t, se.Close(context.Background()))
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	assert.Equal(t, "evicted-irrelevant", EvictedIrrelevant.String())
+}
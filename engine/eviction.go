@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"math"
+)
+
+// EvictionPolicy decides which rows are evicted once the cache is full.
+// Implementations must be safe for concurrent use, as OnAccess is called
+// concurrently with everything else. The other methods are called while the
+// engine holds its top level lock and must not call back into the engine.
+type EvictionPolicy interface {
+
+	// OnAccess is called for every Get of key, cache hit or not, some time
+	// after the Get from a single goroutine. Accesses of the same key are
+	// passed in order, but may be dropped under load, see AccessOverflow.
+	OnAccess(key string)
+
+	// OnInsert is called whenever a value of size bytes is stored under key,
+	// including when it replaces a previous value.
+	OnInsert(key string, size int)
+
+	// OnDelete is called whenever key is removed from the cache, for any
+	// reason. It may be called for keys the policy does not know about.
+	OnDelete(key string)
+
+	// Victims calls yield with keys in the order in which they are to be
+	// evicted until yield returns false, or until there are no more keys.
+	// The engine calls OnDelete for every yielded key once Victims returns.
+	Victims(yield func(key string) bool)
+}
+
+// skiplistHeight is log2(expectedLen)-1.
+func skiplistHeight(expectedLen int64) int {
+	return int(math.Floor(math.Log2(float64(expectedLen / 2))))
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func victims(p EvictionPolicy, n int) string {
+	var keys string
+	p.Victims(func(key string) bool {
+		keys += key
+		n--
+		return n > 0
+	})
+	return keys
+}
+
+func TestLRUPolicy(t *testing.T) {
+	p := NewLRUPolicy()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.OnInsert(k, 1)
+	}
+	p.OnAccess("a")
+	p.OnAccess("c")
+	p.OnAccess("z") // unknown
+	p.OnDelete("d")
+	p.OnDelete("z")
+
+	assert.Equal(t, "bac", victims(p, 10))
+	assert.Equal(t, "b", victims(p, 1))
+}
+
+func TestLFUPolicy(t *testing.T) {
+	p := NewLFUPolicy(1024)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.OnInsert(k, 1)
+	}
+	for i := 0; i < 3; i++ {
+		p.OnAccess("a")
+	}
+	p.OnAccess("b")
+	p.OnAccess("b")
+	p.OnAccess("c")
+	p.OnInsert("c", 1) // replacing keeps the count
+	p.OnDelete("d")
+
+	assert.Equal(t, "cba", victims(p, 10))
+}
+
+func TestWTinyLFUPolicy(t *testing.T) {
+	p := NewWTinyLFUPolicy(1024)
+	for i := 0; i < 300; i++ {
+		p.OnAccess("hot")
+	}
+	for _, k := range []string{"hot", "a", "b", "c"} {
+		p.OnInsert(k, 1)
+	}
+	p.OnAccess("b")
+	p.OnAccess("b")
+
+	// window is 1 key long: "c" is the candidate, "hot" is the main
+	// segment's victim, "a" went to probation after it and "b" got protected
+	assert.Equal(t, "c", victims(p, 1))
+	p.OnInsert("d", 1)
+	assert.Equal(t, "d", victims(p, 1))
+
+	// a hotter candidate is admitted
+	for i := 0; i < 400; i++ {
+		p.OnAccess("e")
+	}
+	p.OnInsert("e", 1)
+	assert.Equal(t, "hot", victims(p, 1))
+	assert.Equal(t, "aeb", victims(p, 10))
+}
+
+func TestARCPolicy(t *testing.T) {
+	p := NewARCPolicy().(*arcPolicy)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.OnInsert(k, 1)
+	}
+	p.OnAccess("a")
+	p.OnAccess("b")
+
+	// t1 holds c, d and is evicted first while longer than p (0)
+	assert.Equal(t, "cd", victims(p, 2))
+	assert.Equal(t, 2, p.b1.Len())
+
+	// ghost hit in b1 grows t1's target
+	p.OnInsert("c", 1)
+	assert.Equal(t, 1, p.p)
+	assert.Equal(t, 3, p.t2.Len())
+
+	p.OnDelete("a")
+	assert.Equal(t, "bc", victims(p, 10))
+	assert.Equal(t, 0, p.t1.Len()+p.t2.Len())
+}
+
+func TestEvictionPolicyOption(t *testing.T) {
+	for _, p := range []EvictionPolicy{
+		NewLRUPolicy(), NewLFUPolicy(1024), NewWTinyLFUPolicy(1024), NewARCPolicy(),
+	} {
+		opts := testOptionsDefault
+		opts.O = &testdummies.ZeroesPayloadOrigin{}
+		opts.MaxPayloadTotalBytes = 10 * 1000 * 1000
+		opts.EvictionPolicy = p
+		e, err := NewEngine(&opts)
+		assert.Nil(t, err)
+		assert.Nil(t, e.stats)
+
+		for i := 0; i < 1500; i++ {
+			_, err = e.Get(strconv.Itoa(i))
+			assert.Nil(t, err)
+		}
+		e.rwm.RLock()
+		assert.True(t, e.payloadTotal <= opts.MaxPayloadTotalBytes)
+		assert.True(t, len(e.data) > 500)
+		e.rwm.RUnlock()
+
+		e.Close(context.Background())
+	}
+}
+
+// Compares the hit ratios of all policies over a Zipf distributed workload of
+// 10k keys, a 10th of which fit in the cache.
+func BenchmarkEvictionPolicies(b *testing.B) {
+
+	policies := map[string]func() EvictionPolicy{
+		"Default":  func() EvictionPolicy { return nil },
+		"LRU":      func() EvictionPolicy { return NewLRUPolicy() },
+		"LFU":      func() EvictionPolicy { return NewLFUPolicy(1024) },
+		"WTinyLFU": func() EvictionPolicy { return NewWTinyLFUPolicy(1024) },
+		"ARC":      func() EvictionPolicy { return NewARCPolicy() },
+	}
+
+	for name, newPolicy := range policies {
+		b.Run(name, func(b *testing.B) {
+
+			opts := testOptionsDefault
+			opts.O = &testdummies.ZeroesPayloadOrigin{}
+			opts.MaxPayloadTotalBytes = 10 * 1000 * 1000
+			opts.EvictionPolicy = newPolicy()
+			e, _ := NewEngine(&opts)
+			defer e.Close(context.Background())
+
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 10*1000-1)
+			var hits int
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := strconv.FormatUint(zipf.Uint64(), 10)
+				if e.tryget(key) != nil {
+					hits++
+				}
+				e.Get(key)
+			}
+			b.ReportMetric(float64(hits)/float64(b.N), "hits/op")
+		})
+	}
+}
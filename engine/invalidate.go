@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// InvalidationBus carries invalidations between engines, typically of
+// different processes serving the same keys, see package bus. An
+// InvalidationBus value is the endpoint of one process, possibly shared by
+// several engines, such as the shards of a ShardedEngine.
+type InvalidationBus interface {
+
+	// Publish passes inv to the subscribers of all other endpoints of the
+	// bus. It may return before they've applied it and must not block for
+	// long.
+	Publish(inv Invalidation)
+
+	// Subscribe has apply called with every invalidation published by the
+	// other endpoints of the bus until unsubscribe is called.
+	Subscribe(apply func(inv Invalidation)) (unsubscribe func())
+}
+
+// Invalidation is what Invalidate, InvalidatePrefix and InvalidateTag publish
+// on the InvalidationBus.
+type Invalidation struct {
+	Keys     []string
+	Prefixes []string
+	Tags     []string
+}
+
+// InvalidatePrefix deletes all keys starting with prefix, like Invalidate,
+// and returns their number. It scans all keys while holding the top level
+// lock.
+func (e *Engine) InvalidatePrefix(prefix string) int {
+	e.rwm.Lock()
+	n := e.invalidatePrefix(prefix)
+	e.rwm.Unlock()
+
+	e.publish(Invalidation{Prefixes: []string{prefix}})
+	return n
+}
+
+// InvalidateTag deletes all keys whose values were tagged with tag by the
+// origin, see Tagger, like Invalidate and returns their number.
+func (e *Engine) InvalidateTag(tag string) int {
+	e.rwm.Lock()
+	n := e.invalidateTag(tag)
+	e.rwm.Unlock()
+
+	e.publish(Invalidation{Tags: []string{tag}})
+	return n
+}
+
+// apply applies an invalidation received from the bus, without publishing it
+// again.
+func (e *Engine) apply(inv Invalidation) {
+	e.rwm.Lock()
+	defer e.rwm.Unlock()
+
+	for _, k := range inv.Keys {
+		e.invalidate(k)
+	}
+	for _, p := range inv.Prefixes {
+		e.invalidatePrefix(p)
+	}
+	for _, t := range inv.Tags {
+		e.invalidateTag(t)
+	}
+}
+
+func (e *Engine) publish(inv Invalidation) {
+	if e.bus != nil && len(inv.Keys)+len(inv.Prefixes)+len(inv.Tags) > 0 {
+		e.bus.Publish(inv)
+	}
+}
+
+// still holding top level lock
+func (e *Engine) invalidatePrefix(prefix string) int {
+	var keys []string
+	for k := range e.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range e.negative {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		e.invalidate(k)
+	}
+	return len(keys)
+}
+
+// still holding top level lock
+func (e *Engine) invalidateTag(tag string) int {
+	keys := make([]string, 0, len(e.tags[tag]))
+	for k := range e.tags[tag] {
+		keys = append(keys, k)
+	}
+
+	for _, k := range keys {
+		e.invalidate(k)
+	}
+	return len(keys)
+}
+
+// still holding top level lock
+func (e *Engine) invalidate(key string) {
+	if _, ok := e.data[key]; ok {
+		atomic.AddUint64(&e.counters.invalidations, 1)
+	}
+	e.delDataTTLStats(key, Invalidated)
+}
+
+// tag associates key with tags, replacing its previous tags.
+// still holding top level lock
+func (e *Engine) tag(key string, tags []string) {
+	e.untag(key)
+	if len(tags) == 0 {
+		return
+	}
+
+	for _, t := range tags {
+		keys, ok := e.tags[t]
+		if !ok {
+			keys = make(map[string]struct{})
+			e.tags[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	e.keyTags[key] = tags
+}
+
+// still holding top level lock
+func (e *Engine) untag(key string) {
+	for _, t := range e.keyTags[key] {
+		delete(e.tags[t], key)
+		if len(e.tags[t]) == 0 {
+			delete(e.tags, t)
+		}
+	}
+	delete(e.keyTags, key)
+}
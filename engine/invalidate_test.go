@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// taggedOrigin tags a value with the comma separated tags following "#" in
+// its key, e.g. "a#red,blue". Values expire in an hour.
+type taggedOrigin struct{}
+
+type taggedBody struct {
+	io.ReadCloser
+	tags []string
+}
+
+func (tb taggedBody) Tags() []string { return tb.tags }
+
+func (taggedOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	var tags []string
+	if i := strings.IndexByte(key, '#'); i >= 0 {
+		tags = strings.Split(key[i+1:], ",")
+	}
+	exp := time.Now().Add(time.Hour)
+	return taggedBody{ioutil.NopCloser(bytes.NewReader([]byte(key))), tags}, &exp, nil
+}
+
+func TestInvalidatePrefix(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = taggedOrigin{}
+	opts.NegativeTTLNotFound = time.Hour
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	for _, k := range []string{"user/1", "user/2", "users", "item/1"} {
+		_, err := e.Get(k)
+		assert.Nil(t, err)
+	}
+	e.rwm.Lock()
+	e.cacheNegative("user/3", ErrNotFound)
+	e.rwm.Unlock()
+
+	assert.Equal(t, 3, e.InvalidatePrefix("user/"))
+	e.accesses.drain(e.stats.addBatch)
+
+	e.rwm.RLock()
+	for _, k := range []string{"user/1", "user/2", "user/3"} {
+		_, ok := e.data[k]
+		assert.False(t, ok)
+		_, ok = e.negative[k]
+		assert.False(t, ok)
+		_, ok = e.ttl.m[k]
+		assert.False(t, ok)
+	}
+	assert.Equal(t, 2, len(e.data))
+	e.rwm.RUnlock()
+	assert.Equal(t, uint64(2), e.Stats().Invalidations)
+
+	assert.Equal(t, 2, e.InvalidatePrefix(""))
+	assert.Equal(t, 0, e.Stats().Keys)
+}
+
+func TestInvalidateTag(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = taggedOrigin{}
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	for _, k := range []string{"a#red,blue", "b#red", "c#blue", "d"} {
+		_, err := e.Get(k)
+		assert.Nil(t, err)
+	}
+	e.accesses.drain(e.stats.addBatch)
+
+	assert.Equal(t, 2, e.InvalidateTag("red"))
+	assert.Equal(t, 0, e.InvalidateTag("red"))
+	assert.Equal(t, 0, e.InvalidateTag("green"))
+
+	e.rwm.RLock()
+	assert.Equal(t, 2, len(e.data))
+	_, ok := e.ttl.m["a#red,blue"]
+	assert.False(t, ok)
+	assert.Equal(t, map[string]struct{}{"c#blue": {}}, e.tags["blue"])
+	assert.Nil(t, e.keyTags["a#red,blue"])
+	e.rwm.RUnlock()
+
+	e.stats.Lock()
+	_, relevant := e.stats.relevantMap["b#red"]
+	_, irrelevant := e.stats.irrelevantMap["b#red"]
+	e.stats.Unlock()
+	assert.False(t, relevant || irrelevant)
+
+	// tags go away with their key
+	e.Invalidate("c#blue")
+	e.rwm.RLock()
+	assert.Equal(t, 0, len(e.tags))
+	assert.Equal(t, 0, len(e.keyTags))
+	e.rwm.RUnlock()
+
+	// and are replaced along with the value
+	e.Get("a#red,blue")
+	assert.Nil(t, e.Set("a#red,blue", []byte("x"), nil))
+	assert.Equal(t, 0, e.InvalidateTag("blue"))
+
+	se, err := NewShardedEngine(&opts, 4)
+	assert.Nil(t, err)
+	defer se.Close(context.Background())
+	for i := 0; i < 20; i++ {
+		se.Get(string(rune('a'+i)) + "#all")
+	}
+	se.Get("z")
+	assert.Equal(t, 20, se.InvalidateTag("all"))
+	assert.Equal(t, 1, se.InvalidatePrefix("z"))
+	assert.Equal(t, 0, se.Stats().Keys)
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"sync"
+
+	"github.com/wv0m56/fury/datastructure/duplist"
+)
+
+type lfuPolicy struct {
+	sync.Mutex
+	dl *duplist.Uint64String // access counts of cached keys
+	m  map[string]*duplist.Uint64StringElement
+}
+
+// NewLFUPolicy returns an EvictionPolicy evicting the least frequently used
+// key first. Among keys accessed equally often, the most recently inserted is
+// evicted first. Access counts are exact and forgotten once a key leaves the
+// cache. expectedLen has the same meaning as in Options.
+func NewLFUPolicy(expectedLen int64) EvictionPolicy {
+	return &lfuPolicy{
+		dl: duplist.NewUint64String(skiplistHeight(expectedLen)),
+		m:  make(map[string]*duplist.Uint64StringElement),
+	}
+}
+
+func (lfu *lfuPolicy) OnAccess(key string) {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	if el, ok := lfu.m[key]; ok {
+		lfu.dl.DelElement(el)
+		lfu.m[key] = lfu.dl.Insert(el.Key()+1, key)
+	}
+}
+
+func (lfu *lfuPolicy) OnInsert(key string, _ int) {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	if _, ok := lfu.m[key]; !ok {
+		lfu.m[key] = lfu.dl.Insert(1, key)
+	}
+}
+
+func (lfu *lfuPolicy) OnDelete(key string) {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	if el, ok := lfu.m[key]; ok {
+		lfu.dl.DelElement(el)
+		delete(lfu.m, key)
+	}
+}
+
+func (lfu *lfuPolicy) Victims(yield func(key string) bool) {
+	lfu.Lock()
+	defer lfu.Unlock()
+
+	for it := lfu.dl.First(); it != nil; it = it.Next() {
+		if !yield(it.Val()) {
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruPolicy struct {
+	sync.Mutex
+	ll *list.List // most recently used at the front
+	m  map[string]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy evicting the least recently used key
+// first.
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{ll: list.New(), m: make(map[string]*list.Element)}
+}
+
+func (lru *lruPolicy) OnAccess(key string) {
+	lru.Lock()
+	defer lru.Unlock()
+
+	if el, ok := lru.m[key]; ok {
+		lru.ll.MoveToFront(el)
+	}
+}
+
+func (lru *lruPolicy) OnInsert(key string, _ int) {
+	lru.Lock()
+	defer lru.Unlock()
+
+	if el, ok := lru.m[key]; ok {
+		lru.ll.MoveToFront(el)
+	} else {
+		lru.m[key] = lru.ll.PushFront(key)
+	}
+}
+
+func (lru *lruPolicy) OnDelete(key string) {
+	lru.Lock()
+	defer lru.Unlock()
+
+	if el, ok := lru.m[key]; ok {
+		lru.ll.Remove(el)
+		delete(lru.m, key)
+	}
+}
+
+func (lru *lruPolicy) Victims(yield func(key string) bool) {
+	lru.Lock()
+	defer lru.Unlock()
+
+	for el := lru.ll.Back(); el != nil; el = el.Prev() {
+		if !yield(el.Value.(string)) {
+			return
+		}
+	}
+}
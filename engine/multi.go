@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GetMulti is like GetContext for several keys at once, returning the values
+// of the keys which could be read and the errors of the others. Cache hits
+// are looked up under a single read lock, cache misses are filled
+// concurrently and coalesced with other fills of the same keys. If the origin
+// implements BatchOrigin, all keys to be fetched are fetched in one call.
+func (e *Engine) GetMulti(ctx context.Context, keys ...string) (
+	map[string]*bytes.Reader, map[string]error) {
+
+	readers := make(map[string]*bytes.Reader, len(keys))
+	errs := make(map[string]error)
+
+	if err := ctx.Err(); err != nil {
+		for _, k := range keys {
+			errs[k] = err
+		}
+		return readers, errs
+	}
+
+	var misses []string
+	seen := make(map[string]bool, len(keys))
+	e.rwm.RLock()
+	for _, k := range keys {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		e.accesses.record(k)
+
+		if r, err := e.lookupLocked(k); r != nil {
+			readers[k] = r
+		} else if err != nil {
+			errs[k] = err
+		} else {
+			misses = append(misses, k)
+		}
+	}
+	e.rwm.RUnlock()
+
+	if len(misses) == 0 {
+		return readers, errs
+	}
+
+	e.rwm.Lock()
+
+	start := e.startFill
+	var bf *batchFill
+	if bo, ok := e.o.(BatchOrigin); ok {
+		bf = e.newBatchFill(ctx, bo)
+		start = bf.add
+	}
+
+	var (
+		waitKeys []string
+		conds    []*condition
+	)
+	for _, k := range misses {
+		b, c, err := e.acquire(ctx, k, start)
+		if err != nil {
+			errs[k] = err
+		} else if c == nil {
+			readers[k] = bytes.NewReader(b)
+		} else {
+			waitKeys = append(waitKeys, k)
+			conds = append(conds, c)
+		}
+	}
+
+	if bf != nil {
+		bf.run()
+	}
+
+	if len(conds) == 0 {
+		e.rwm.Unlock()
+		return readers, errs
+	}
+
+	// all fills are running, waiting on them one by one takes as long as the
+	// slowest one
+	for i, k := range waitKeys {
+		if i > 0 {
+			e.rwm.Lock()
+		}
+		if r, err := e.blockUntilFilled(ctx, k, conds[i]); err != nil {
+			errs[k] = err
+		} else {
+			readers[k] = r
+		}
+	}
+
+	return readers, errs
+}
+
+// batchFill is a fillStarter collecting keys to be fetched by a BatchOrigin
+// in a single call. The fetch is cancelled once all of its fills are
+// abandoned.
+type batchFill struct {
+	e      *Engine
+	bo     BatchOrigin
+	ctx    context.Context
+	cancel context.CancelFunc
+	live   int32 // fills not finished or abandoned, atomically
+	keys   []string
+	conds  []*condition
+}
+
+func (e *Engine) newBatchFill(ctx context.Context, bo BatchOrigin) *batchFill {
+	fillCtx, cancel := context.WithTimeout(e.ctx, e.timeout)
+	return &batchFill{
+		e:      e,
+		bo:     bo,
+		ctx:    fillContext{fillCtx, ctx},
+		cancel: cancel,
+	}
+}
+
+// still holding top level lock
+func (bf *batchFill) add(_ context.Context, key string, count int) *condition {
+	e := bf.e
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			if atomic.AddInt32(&bf.live, -1) == 0 {
+				bf.cancel()
+			}
+		})
+	}
+
+	c := &condition{*sync.NewCond(e.rwm), count, nil, nil, cancel, count == 0,
+		newStreamBuffer()}
+	e.fillCond[key] = c
+	e.fills.Add(1)
+	atomic.AddUint64(&e.counters.fills, 1)
+
+	atomic.AddInt32(&bf.live, 1)
+	bf.keys = append(bf.keys, key)
+	bf.conds = append(bf.conds, c)
+
+	return c
+}
+
+// run launches the fetch of all collected keys, if any.
+// still holding top level lock
+func (bf *batchFill) run() {
+	if len(bf.keys) == 0 {
+		bf.cancel()
+		return
+	}
+
+	go func() {
+		start := time.Now()
+
+		results, err := bf.bo.FetchMulti(bf.ctx, bf.keys)
+		if err == nil && len(results) != len(bf.keys) {
+			err = fmt.Errorf("FetchMulti returned %d results for %d keys",
+				len(results), len(bf.keys))
+		}
+		if err != nil {
+			for _, r := range results {
+				if r.Body != nil {
+					_ = r.Body.Close()
+				}
+			}
+			results = make([]FetchResult, len(bf.keys))
+			for i := range results {
+				results[i].Err = err
+			}
+		}
+
+		for i, k := range bf.keys {
+			r := results[i]
+			bf.e.completeFill(k, bf.conds[i], start, r.Body, r.Expiry, r.Err, false)
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+// batchOrigin fetches keys one by one with Fetch and all at once with
+// FetchMulti, which fails keys prefixed by "404" and fails as a whole when
+// asked for "broken".
+type batchOrigin struct {
+	sync.Mutex
+	batches [][]string
+	delay   time.Duration
+}
+
+func (bo *batchOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return ioutil.NopCloser(bytes.NewReader([]byte(key))), nil, nil
+}
+
+func (bo *batchOrigin) FetchMulti(ctx context.Context, keys []string) (
+	[]FetchResult, error) {
+
+	bo.Lock()
+	bo.batches = append(bo.batches, keys)
+	bo.Unlock()
+
+	select {
+	case <-time.After(bo.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	results := make([]FetchResult, len(keys))
+	for i, k := range keys {
+		switch {
+		case k == "broken":
+			return nil, errors.New("broken batch")
+		case len(k) >= 3 && k[:3] == "404":
+			results[i].Err = fmt.Errorf("%s: %w", k, ErrNotFound)
+		default:
+			results[i].Body = ioutil.NopCloser(bytes.NewReader([]byte(k)))
+		}
+	}
+	return results, nil
+}
+
+func TestGetMulti(t *testing.T) {
+
+	e, err := NewEngine(&testOptionsDefault) // origin has 100 ms delay
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	e.Get("a")
+
+	start := time.Now()
+	readers, errs := e.GetMulti(context.Background(), "a", "b", "c", "d", "error", "b")
+	assert.True(t, time.Since(start) < 190*time.Millisecond) // concurrently
+	assert.Equal(t, 4, len(readers))
+	for k, r := range readers {
+		b, _ := ioutil.ReadAll(r)
+		assert.Equal(t, k, string(b))
+	}
+	assert.Equal(t, 1, len(errs))
+	assert.NotNil(t, errs["error"])
+
+	// coalesced with a concurrent Get
+	go e.Get("e")
+	time.Sleep(10 * time.Millisecond)
+	readers, errs = e.GetMulti(context.Background(), "e", "f")
+	assert.Equal(t, 2, len(readers))
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, uint64(1), e.Stats().Coalesced)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	readers, errs = e.GetMulti(ctx, "a", "g")
+	assert.Equal(t, 1, len(readers))
+	assert.Equal(t, context.DeadlineExceeded, errs["g"])
+}
+
+func TestGetMultiBatchOrigin(t *testing.T) {
+
+	bo := &batchOrigin{delay: 20 * time.Millisecond}
+	opts := testOptionsDefault
+	opts.O = bo
+	opts.NegativeTTLNotFound = time.Minute
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	e.Get("a")
+
+	readers, errs := e.GetMulti(context.Background(), "a", "b", "c", "404")
+	assert.Equal(t, 3, len(readers))
+	assert.True(t, errors.Is(errs["404"], ErrNotFound))
+	assert.Equal(t, [][]string{{"b", "c", "404"}}, bo.batches)
+	assert.NotNil(t, e.tryget("c"))
+
+	// cached, negatively too
+	readers, errs = e.GetMulti(context.Background(), "b", "404")
+	assert.Equal(t, 1, len(readers))
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, 1, len(bo.batches))
+
+	readers, errs = e.GetMulti(context.Background(), "d", "broken")
+	assert.Equal(t, 0, len(readers))
+	assert.Equal(t, "broken batch", errs["d"].Error())
+	assert.Equal(t, "broken batch", errs["broken"].Error())
+
+	// abandoned by all waiters, the batch only ending once canceled
+	bo.delay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, errs = e.GetMulti(ctx, "x", "y")
+	assert.Equal(t, context.DeadlineExceeded, errs["x"])
+	assert.Eventually(t, func() bool { return e.Stats().InFlightFills == 0 },
+		time.Second, time.Millisecond)
+	assert.Nil(t, e.tryget("x"))
+}
+
+func TestShardedGetMulti(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	se, err := NewShardedEngine(&opts, 4)
+	assert.Nil(t, err)
+	defer se.Close(context.Background())
+
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	readers, errs := se.GetMulti(context.Background(), keys...)
+	assert.Equal(t, len(keys), len(readers))
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, len(keys), se.Stats().Keys)
+}
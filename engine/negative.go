@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// cacheNegative remembers err as the result of fetching key for a while,
+// unless err is ErrClosed or the cache fill got abandoned by its waiters.
+// still holding top level lock
+func (e *Engine) cacheNegative(key string, err error) {
+
+	if err == ErrClosed || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if _, ok := e.data[key]; ok {
+		return
+	}
+
+	ttl := e.negativeTTLError
+	if errors.Is(err, ErrNotFound) {
+		ttl = e.negativeTTLNotFound
+	}
+
+	if ttl > 0 {
+		e.negative[key] = err
+		e.setExpiry(key, time.Now().Add(ttl))
+	}
+}
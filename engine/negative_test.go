@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// notFoundOrigin fails keys prefixed by "404" with a wrapped ErrNotFound and all
+// other keys with a transient error.
+type notFoundOrigin struct {
+	fetches int32
+}
+
+func (nfo *notFoundOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	atomic.AddInt32(&nfo.fetches, 1)
+	if len(key) >= 3 && key[:3] == "404" {
+		return nil, nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return nil, nil, errors.New("transient")
+}
+
+func TestNegativeCaching(t *testing.T) {
+
+	o := &notFoundOrigin{}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	opts.NegativeTTLNotFound = time.Minute
+	opts.NegativeTTLError = 20 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	for i := 0; i < 10; i++ {
+		_, err = e.Get("404/a")
+		assert.True(t, errors.Is(err, ErrNotFound))
+		_, err = e.Get("b")
+		assert.Equal(t, "transient", err.Error())
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&o.fetches))
+
+	st := e.Stats()
+	assert.Equal(t, 2, st.NegativeKeys)
+	assert.Equal(t, uint64(18), st.NegativeHits)
+	assert.Equal(t, 0, st.Keys)
+
+	// no rows, hence no TTLs
+	assert.Equal(t, 0, st.TTLKeys)
+	assert.Equal(t, []float64{-1, -1}, e.GetTTL("404/a", "b"))
+	assert.Equal(t, 0, e.ExpiringWithin(time.Hour))
+
+	// transient errors expire sooner
+	assert.Eventually(t, func() bool { return e.Stats().NegativeKeys == 1 },
+		time.Second, time.Millisecond)
+	_, err = e.Get("b")
+	assert.NotNil(t, err)
+	_, err = e.Get("404/a")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&o.fetches))
+
+	// a pushed value replaces the cached error
+	assert.Nil(t, e.Set("404/a", []byte("found"), nil))
+	_, err = e.Get("404/a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, e.Stats().NegativeKeys)
+
+	e.Invalidate("b")
+	assert.Equal(t, 0, e.Stats().NegativeKeys)
+}
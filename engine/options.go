@@ -11,6 +11,11 @@ type Options struct {
 	// NewEngine panics if ExpectedLen less than 1024 (pointless).
 	ExpectedLen int64
 
+	// AccessStatsRelevanceWindow and AccessStatsTickStep configure the
+	// default eviction policy, which evicts rows not accessed within the
+	// relevance window first, least frequently accessed first.
+	// Accesses reach the eviction policy, default or not, in batches and at
+	// least once per AccessStatsTickStep.
 	AccessStatsRelevanceWindow time.Duration
 	AccessStatsTickStep        time.Duration
 	TTLTickStep                time.Duration
@@ -21,4 +26,61 @@ type Options struct {
 	// (in bytes) from all rows.
 	// It must be greater than 10*1000*1000 bytes.
 	MaxPayloadTotalBytes int64
+
+	// MaxItemBytes is the maximum length of a single value. Larger values
+	// fetched from the origin are passed to the waiting callers without being
+	// cached, and refused by Set. Zero means MaxPayloadTotalBytes.
+	MaxItemBytes int64
+
+	// Admission makes a full cache only admit a fetched value if its key is
+	// estimated to be accessed more frequently than the first key to be
+	// evicted in its place (TinyLFU). Replaced keys and Set are not subject to
+	// admission. It requires the default eviction policy.
+	Admission bool
+
+	// StaleWhileRevalidate is for how long past its expiry a row is still
+	// served while a single background cache fill refreshes it.
+	// Zero means expired rows are deleted right away.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is for how long past its expiry a row is served in place
+	// of a failed refresh.
+	// Both can be overridden per key by the origin, see Staler.
+	StaleIfError time.Duration
+
+	// NegativeTTLNotFound is for how long an ErrNotFound from the origin is
+	// cached and returned by Get without asking the origin again.
+	// NegativeTTLError is the same for all other origin errors.
+	// Zero disables negative caching.
+	NegativeTTLNotFound time.Duration
+	NegativeTTLError    time.Duration
+
+	// EvictionPolicy replaces the default eviction policy if not nil, e.g.
+	// with NewLRUPolicy, NewLFUPolicy, NewWTinyLFUPolicy or NewARCPolicy.
+	EvictionPolicy EvictionPolicy
+
+	// NewEvictionPolicy creates the eviction policy if EvictionPolicy is nil.
+	// Unlike EvictionPolicy, it can be used with NewShardedEngine which needs
+	// one policy per shard. It's passed the ExpectedLen of the (shard)
+	// engine, e.g. NewLFUPolicy.
+	NewEvictionPolicy func(expectedLen int64) EvictionPolicy
+
+	// AccessBufferSize is the number of batches of accesses queued for the
+	// eviction policy, 16 if zero. AccessOverflow decides what happens to
+	// further accesses, DropAccesses by default.
+	AccessBufferSize int
+	AccessOverflow   AccessOverflow
+
+	// TTLIndex orders keys by expiry, SkiplistTTL by default.
+	TTLIndex TTLIndex
+
+	// SkiplistSeed, if not zero, seeds the random layout of the engine's
+	// skiplists, which is otherwise seeded with the current time. Engines
+	// created with the same seed and fed the same operations in the same
+	// order lay them out identically, e.g. for reproducible tests.
+	SkiplistSeed int64
+
+	// InvalidationBus, if not nil, carries the invalidations of this engine
+	// to the other engines on the bus and theirs to this one.
+	InvalidationBus InvalidationBus
 }
@@ -1,10 +1,25 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"io"
 	"time"
 )
 
+var (
+	// ErrNotFound is to be returned by Origin implementations (possibly
+	// wrapped) when key does not exist at the backend. Not-found results are
+	// cached for Options.NegativeTTLNotFound.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNotModified is to be returned by Origin implementations, along with
+	// a new expiry, when the validator passed in the context of FetchContext
+	// shows the cached value to be still up to date. The engine then only
+	// updates the key's expiry.
+	ErrNotModified = errors.New("not modified")
+)
+
 // Origin is to be implemented by objects which fetches data from the cache
 // engine's backend.
 // Fetch fetches the data associated with key (usually over the network)
@@ -13,3 +28,100 @@ import (
 type Origin interface {
 	Fetch(key string, timeout time.Duration) (io.ReadCloser, *time.Time, error)
 }
+
+// ContextOrigin is an optional interface for an Origin. If the origin passed
+// into Options implements it, FetchContext is called in place of Fetch.
+// ctx is done once Options.CacheFillTimeout elapses or once every caller
+// waiting on the cache fill has given up, and carries the values of the
+// context passed into GetContext by the caller which triggered the fill.
+type ContextOrigin interface {
+	FetchContext(ctx context.Context, key string) (io.ReadCloser, *time.Time, error)
+}
+
+// Staler is an optional interface for the io.ReadCloser returned by Fetch. It
+// overrides Options.StaleWhileRevalidate and Options.StaleIfError for the
+// fetched key. Zero durations defer to Options.
+type Staler interface {
+	Stale() (whileRevalidate, ifError time.Duration)
+}
+
+// Validator is an optional interface for the io.ReadCloser returned by Fetch.
+// The engine remembers the opaque validator (e.g. an HTTP ETag) of the
+// fetched value and passes it into the next FetchContext of the same key, see
+// ValidatorFromContext.
+type Validator interface {
+	Validator() string
+}
+
+// Tagger is an optional interface for the io.ReadCloser returned by Fetch. The
+// fetched value is tagged with Tags, see Engine.InvalidateTag.
+type Tagger interface {
+	Tags() []string
+}
+
+type validatorKey struct{}
+
+// ValidatorFromContext returns the validator of the value cached for the key
+// being fetched, if any.
+func ValidatorFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(validatorKey{}).(string)
+	return v, ok
+}
+
+// FromContextOrigin turns a ContextOrigin into an Origin, to be used as
+// Options.O.
+func FromContextOrigin(co ContextOrigin) Origin {
+	return contextOriginAdapter{co}
+}
+
+type contextOriginAdapter struct {
+	ContextOrigin
+}
+
+func (coa contextOriginAdapter) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	rc, exp, err := coa.FetchContext(ctx, key)
+	if err != nil || rc == nil {
+		cancel()
+		return rc, exp, err
+	}
+	return &cancelReadCloser{rc, cancel}, exp, nil
+}
+
+// cancelReadCloser releases the context of a Fetch once its body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (crc *cancelReadCloser) Close() error {
+	defer crc.cancel()
+	return crc.ReadCloser.Close()
+}
+
+// unwrapBody returns the body of a Fetch made through FromContextOrigin as
+// FetchContext returned it, so that its optional interfaces are found.
+func unwrapBody(rc io.ReadCloser) io.ReadCloser {
+	if crc, ok := rc.(*cancelReadCloser); ok {
+		return crc.ReadCloser
+	}
+	return rc
+}
+
+// BatchOrigin is an optional interface for Origin implementations which can
+// fetch several keys in a single round trip. GetMulti passes it all requested
+// keys which are neither cached nor being fetched already.
+type BatchOrigin interface {
+	// FetchMulti returns the results of keys in the order of keys, or an
+	// error applying to all of them. Bodies are read one after the other.
+	FetchMulti(ctx context.Context, keys []string) ([]FetchResult, error)
+}
+
+// FetchResult is the result of fetching a single key, see Origin.Fetch.
+type FetchResult struct {
+	Body   io.ReadCloser
+	Expiry *time.Time
+	Err    error
+}
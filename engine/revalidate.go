@@ -0,0 +1,27 @@
+package engine
+
+import (
+	"time"
+)
+
+// revalidate marks the cached value of key as up to date again, expiring at
+// exp, or at its previous expiry if exp is nil. A revalidation which is
+// already expired changes nothing.
+// still holding top level lock
+func (e *Engine) revalidate(key string, exp *time.Time) {
+
+	if exp == nil {
+		sr, stale := e.stale[key]
+		if !stale {
+			return // expiring as before
+		}
+		exp = &sr.expiredAt
+	}
+
+	if !exp.After(time.Now()) {
+		return
+	}
+
+	delete(e.stale, key)
+	e.setExpiry(key, *exp)
+}
@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// revalidatingOrigin serves every key for 30ms as version "v1", answering
+// ErrNotModified to fetches carrying that validator.
+type revalidatingOrigin struct {
+	fetches, notModified int32
+}
+
+type versionedBody struct {
+	io.ReadCloser
+	version string
+}
+
+func (vb versionedBody) Validator() string { return vb.version }
+
+func (ro *revalidatingOrigin) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return FromContextOrigin(ro).Fetch(key, timeout)
+}
+
+func (ro *revalidatingOrigin) FetchContext(ctx context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	atomic.AddInt32(&ro.fetches, 1)
+	exp := time.Now().Add(30 * time.Millisecond)
+
+	if v, ok := ValidatorFromContext(ctx); ok && v == "v1" {
+		atomic.AddInt32(&ro.notModified, 1)
+		return nil, &exp, ErrNotModified
+	}
+
+	body := ioutil.NopCloser(bytes.NewReader([]byte(key)))
+	return versionedBody{body, "v1"}, &exp, nil
+}
+
+func TestRevalidate(t *testing.T) {
+
+	o := &revalidatingOrigin{}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	r, err := e.Get("a")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "a", string(b))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, e.tryget("a")) // expired, kept for revalidation only
+
+	r, err = e.Get("a")
+	assert.Nil(t, err)
+	b, _ = ioutil.ReadAll(r)
+	assert.Equal(t, "a", string(b))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&o.fetches))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&o.notModified))
+	assert.NotNil(t, e.tryget("a"))
+	assert.True(t, e.GetTTL("a")[0] > 0)
+
+	// gone for good, the next fetch is unconditional
+	e.Invalidate("a")
+	r, err = e.Get("a")
+	assert.Nil(t, err)
+	b, _ = ioutil.ReadAll(r)
+	assert.Equal(t, "a", string(b))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&o.fetches))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&o.notModified))
+}
+
+// conditionalOrigin serves every key for 30ms as version "v1". Fetches
+// carrying that validator are answered ErrNotModified, without expiry if
+// noExpiry, after calling notModified if set.
+type conditionalOrigin struct {
+	noExpiry    bool
+	notModified func(key string)
+	fetches     int32
+}
+
+func (co *conditionalOrigin) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return FromContextOrigin(co).Fetch(key, timeout)
+}
+
+func (co *conditionalOrigin) FetchContext(ctx context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	atomic.AddInt32(&co.fetches, 1)
+	exp := time.Now().Add(30 * time.Millisecond)
+
+	if v, ok := ValidatorFromContext(ctx); ok && v == "v1" {
+		if co.notModified != nil {
+			co.notModified(key)
+		}
+		if co.noExpiry {
+			return nil, nil, ErrNotModified
+		}
+		return nil, &exp, ErrNotModified
+	}
+
+	body := ioutil.NopCloser(bytes.NewReader([]byte(key)))
+	return versionedBody{body, "v1"}, &exp, nil
+}
+
+func TestRevalidateEvicted(t *testing.T) {
+
+	o := &conditionalOrigin{}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+	o.notModified = func(key string) { e.Invalidate(key) }
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+	assert.Eventually(t, isStale(e, "a"), time.Second, time.Millisecond)
+
+	// not modified, but gone by then, fetched unconditionally
+	r, err := e.Get("a")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "a", string(b))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&o.fetches))
+	assert.NotNil(t, e.tryget("a"))
+	assert.Equal(t, 0, e.Stats().NegativeKeys)
+}
+
+func TestRevalidateWithoutExpiry(t *testing.T) {
+
+	o := &conditionalOrigin{noExpiry: true}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+	assert.Eventually(t, isStale(e, "a"), time.Second, time.Millisecond)
+
+	// still expired as before, so revalidated again by the next Get
+	for i := 0; i < 2; i++ {
+		r, err := e.Get("a")
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "a", string(b))
+		assert.True(t, isStale(e, "a")())
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&o.fetches))
+}
+
+// plainOrigin only has the Fetch of FromContextOrigin, whose bodies are
+// wrapped to release their context once closed.
+type plainOrigin struct {
+	co ContextOrigin
+}
+
+func (po plainOrigin) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return FromContextOrigin(po.co).Fetch(key, timeout)
+}
+
+type richBody struct {
+	io.ReadCloser
+}
+
+func (richBody) Stale() (time.Duration, time.Duration) { return time.Minute, time.Hour }
+func (richBody) Validator() string                     { return "v1" }
+func (richBody) Tags() []string                        { return []string{"red"} }
+
+type richOrigin struct{}
+
+func (richOrigin) FetchContext(_ context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	return richBody{ioutil.NopCloser(bytes.NewReader([]byte(key)))}, nil, nil
+}
+
+func TestWrappedBodyInterfaces(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = plainOrigin{richOrigin{}}
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+
+	e.rwm.RLock()
+	assert.Equal(t, staleness{time.Minute, time.Hour}, e.grace["a"])
+	assert.Equal(t, "v1", e.validators["a"])
+	e.rwm.RUnlock()
+	assert.Equal(t, 1, e.InvalidateTag("red"))
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AccessOverflow decides what happens to recorded accesses when the eviction
+// policy can't keep up with them.
+type AccessOverflow int
+
+const (
+	// DropAccesses loses the accesses, leaving the eviction policy with
+	// approximate statistics. Gets never wait.
+	DropAccesses AccessOverflow = iota
+
+	// BlockAccesses makes Gets wait for the eviction policy to catch up.
+	BlockAccesses
+)
+
+// accessStripeLen is the number of accesses handed to the eviction policy
+// at once.
+const accessStripeLen = 64
+
+// accessBuffer records accesses for the eviction policy without spawning a
+// goroutine or taking a shared lock per Get. Accesses go into one of several
+// stripes by the hash of their key, so that those of a key stay in order.
+// Full stripes are queued as a batch for the loop draining the buffer, which
+// also drains partly filled stripes on every tick.
+type accessBuffer struct {
+	stripes  []accessStripe
+	mask     uint64
+	batches  chan []string
+	overflow AccessOverflow
+	done     <-chan struct{}
+	dropped  uint64 // atomically
+}
+
+type accessStripe struct {
+	sync.Mutex
+	keys [accessStripeLen]string
+	n    int
+	_    [64]byte // keep stripes on separate cache lines
+}
+
+// newAccessBuffer queues up to size batches before overflowing.
+func newAccessBuffer(size int, overflow AccessOverflow, done <-chan struct{}) *accessBuffer {
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n *= 2
+	}
+	return &accessBuffer{
+		stripes:  make([]accessStripe, n),
+		mask:     uint64(n - 1),
+		batches:  make(chan []string, size),
+		overflow: overflow,
+		done:     done,
+	}
+}
+
+func (ab *accessBuffer) record(key string) {
+	// high bits, as the low ones pick the shard of a ShardedEngine
+	s := &ab.stripes[(fnv64a(key)>>32)&ab.mask]
+
+	s.Lock()
+	s.keys[s.n] = key
+	s.n++
+	if s.n < accessStripeLen {
+		s.Unlock()
+		return
+	}
+	batch := s.take()
+	s.Unlock()
+
+	ab.push(batch)
+}
+
+// still holding the stripe's lock
+func (s *accessStripe) take() []string {
+	batch := make([]string, s.n)
+	copy(batch, s.keys[:s.n])
+	for i := range s.keys[:s.n] {
+		s.keys[i] = "" // don't keep keys alive
+	}
+	s.n = 0
+	return batch
+}
+
+func (ab *accessBuffer) push(batch []string) {
+	if ab.overflow == BlockAccesses {
+		select {
+		case ab.batches <- batch:
+		case <-ab.done:
+		}
+		return
+	}
+
+	select {
+	case ab.batches <- batch:
+	default:
+		atomic.AddUint64(&ab.dropped, uint64(len(batch)))
+	}
+}
+
+// drain passes all accesses recorded so far to consume.
+func (ab *accessBuffer) drain(consume func(keys []string)) {
+	for queued := true; queued; {
+		select {
+		case batch := <-ab.batches:
+			consume(batch)
+		default:
+			queued = false
+		}
+	}
+
+	for i := range ab.stripes {
+		s := &ab.stripes[i]
+		s.Lock()
+		if s.n == 0 {
+			s.Unlock()
+			continue
+		}
+		batch := s.take()
+		s.Unlock()
+		consume(batch)
+	}
+}
+
+// loop drains the buffer into consume as batches fill up and on every tick,
+// returns once done is closed.
+func (ab *accessBuffer) loop(step time.Duration, done <-chan struct{},
+	consume func(keys []string)) {
+
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case batch := <-ab.batches:
+			consume(batch)
+		case <-ticker.C:
+			ab.drain(consume)
+		}
+	}
+}
+
+// fnv64a hashes s without allocating.
+func fnv64a(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tylertreat/BoomFilters"
+	"github.com/wv0m56/fury/datastructure/duplist"
+	"github.com/wv0m56/fury/datastructure/linkedlist"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func TestAccessBuffer(t *testing.T) {
+
+	done := make(chan struct{})
+	ab := newAccessBuffer(1, DropAccesses, done)
+
+	var got []string
+	consume := func(keys []string) { got = append(got, keys...) }
+
+	for i := 0; i < accessStripeLen; i++ {
+		ab.record(strconv.Itoa(i % 2))
+	}
+	assert.Equal(t, 1, len(ab.batches))
+	for i := 0; i < accessStripeLen+1; i++ {
+		ab.record("a")
+	}
+	assert.Equal(t, 1, len(ab.batches))
+	assert.Equal(t, uint64(accessStripeLen), atomic.LoadUint64(&ab.dropped))
+
+	ab.drain(consume)
+	assert.Equal(t, accessStripeLen+1, len(got))
+	assert.Equal(t, "a", got[accessStripeLen])
+	for i, k := range got[:accessStripeLen] {
+		assert.Equal(t, strconv.Itoa(i%2), k) // in order
+	}
+
+	got = nil
+	ab.drain(consume)
+	assert.Nil(t, got)
+
+	// blocking until drained or done
+	ab = newAccessBuffer(1, BlockAccesses, done)
+	recorded := make(chan struct{})
+	go func() {
+		for i := 0; i < 3*accessStripeLen; i++ {
+			ab.record("b")
+		}
+		close(recorded)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-recorded:
+		t.Fatal("should block")
+	default:
+	}
+	ab.drain(consume)
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	<-recorded
+	assert.Equal(t, uint64(0), atomic.LoadUint64(&ab.dropped))
+}
+
+type recordingPolicy struct {
+	EvictionPolicy
+	sync.Mutex
+	accessed []string
+}
+
+func (rp *recordingPolicy) OnAccess(key string) {
+	rp.Lock()
+	rp.accessed = append(rp.accessed, key)
+	rp.Unlock()
+	rp.EvictionPolicy.OnAccess(key)
+}
+
+func TestAccessesReachPolicy(t *testing.T) {
+
+	rp := &recordingPolicy{EvictionPolicy: NewLRUPolicy()}
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	opts.AccessStatsTickStep = 10 * time.Millisecond
+	opts.EvictionPolicy = rp
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	e.Get("a")
+	e.Get("b")
+	e.Get("a")
+
+	time.Sleep(50 * time.Millisecond)
+	rp.Lock()
+	assert.Equal(t, 3, len(rp.accessed))
+	rp.Unlock()
+}
+
+func newTestStats() *accessStats {
+	return &accessStats{
+		sync.Mutex{},
+		boom.NewCountMinSketch(0.001, 0.99),
+		&linkedlist.TimeString{},
+		duplist.NewUint64String(24),
+		map[string]relevantTuple{},
+		time.Hour,
+		duplist.NewUint64String(24),
+		map[string]*duplist.Uint64StringElement{},
+	}
+}
+
+// BenchmarkAccessGoroutine records accesses with a goroutine each, as Get
+// used to, for comparison with BenchmarkAccessBuffer.
+func BenchmarkAccessGoroutine(b *testing.B) {
+	as := newTestStats()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		go as.OnAccess("key")
+	}
+}
+
+func BenchmarkAccessBuffer(b *testing.B) {
+	as := newTestStats()
+	done := make(chan struct{})
+	defer close(done)
+	ab := newAccessBuffer(16, DropAccesses, done)
+	go as.startLoop(time.Second, done, ab)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ab.record("key")
+	}
+}
+
+func BenchmarkGetHit(b *testing.B) {
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	e, _ := NewEngine(&opts)
+	defer e.Close(context.Background())
+	e.Get("key")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Get("key")
+	}
+}
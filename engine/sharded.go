@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ShardedEngine spreads keys by hash over independent Engines, each with its
+// own lock, cache fills, TTL index, eviction policy and share of
+// MaxPayloadTotalBytes. Its methods behave like those of Engine, but
+// operations on keys of different shards never wait on each other.
+// Since the payload budget is split statically, a single value can't be
+// larger than MaxPayloadTotalBytes divided by the number of shards, and a
+// shard may evict while others still have room.
+type ShardedEngine struct {
+	shards []*Engine
+}
+
+// NewShardedEngine creates a cache engine of the given number of shards.
+// ExpectedLen and MaxPayloadTotalBytes of opts apply to all shards together,
+// and ExpectedLen must still be at least 1024 once split.
+// Options.EvictionPolicy can't be shared among shards and must be nil, see
+// Options.NewEvictionPolicy instead.
+func NewShardedEngine(opts *Options, shards int) (*ShardedEngine, error) {
+
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+
+	if shards < 1 {
+		return nil, errors.New("shards must be >= 1")
+	}
+
+	if opts.EvictionPolicy != nil {
+		return nil, errors.New("EvictionPolicy can't be shared by shards, use NewEvictionPolicy")
+	}
+
+	// the smallest share, sizing the skiplists of a shard
+	if opts.ExpectedLen/int64(shards) < 1024 {
+		return nil, errors.New("ExpectedLen must be >= 1024 per shard")
+	}
+
+	se := &ShardedEngine{make([]*Engine, shards)}
+	for i := range se.shards {
+		shardOpts := *opts
+		shardOpts.ExpectedLen = split(opts.ExpectedLen, shards, i)
+		shardOpts.MaxPayloadTotalBytes = split(opts.MaxPayloadTotalBytes, shards, i)
+		if shardOpts.MaxItemBytes > shardOpts.MaxPayloadTotalBytes {
+			shardOpts.MaxItemBytes = shardOpts.MaxPayloadTotalBytes
+		}
+		se.shards[i] = newEngine(&shardOpts)
+	}
+
+	return se, nil
+}
+
+// split returns the i-th of n shares of total, the remainder going to the
+// first shares.
+func split(total int64, n, i int) int64 {
+	share := total / int64(n)
+	if int64(i) < total%int64(n) {
+		share++
+	}
+	return share
+}
+
+func (se *ShardedEngine) shard(key string) *Engine {
+	return se.shards[fnv64a(key)%uint64(len(se.shards))]
+}
+
+func (se *ShardedEngine) Get(key string) (*bytes.Reader, error) {
+	return se.shard(key).Get(key)
+}
+
+func (se *ShardedEngine) GetContext(ctx context.Context, key string) (*bytes.Reader, error) {
+	return se.shard(key).GetContext(ctx, key)
+}
+
+func (se *ShardedEngine) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	return se.shard(key).GetStream(ctx, key)
+}
+
+// GetMulti is like Engine.GetMulti, with the keys of each shard looked up
+// concurrently.
+func (se *ShardedEngine) GetMulti(ctx context.Context, keys ...string) (
+	map[string]*bytes.Reader, map[string]error) {
+
+	perShard := make(map[*Engine][]string)
+	for _, k := range keys {
+		e := se.shard(k)
+		perShard[e] = append(perShard[e], k)
+	}
+
+	readers := make(map[string]*bytes.Reader, len(keys))
+	errs := make(map[string]error)
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for e, keys := range perShard {
+		wg.Add(1)
+		go func(e *Engine, keys []string) {
+			defer wg.Done()
+			r, err := e.GetMulti(ctx, keys...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range r {
+				readers[k] = v
+			}
+			for k, v := range err {
+				errs[k] = v
+			}
+		}(e, keys)
+	}
+	wg.Wait()
+
+	return readers, errs
+}
+
+func (se *ShardedEngine) Set(key string, value []byte, expiry *time.Time) error {
+	return se.shard(key).Set(key, value, expiry)
+}
+
+func (se *ShardedEngine) SetReader(key string, r io.Reader, expiry *time.Time) error {
+	return se.shard(key).SetReader(key, r, expiry)
+}
+
+// Invalidate, InvalidatePrefix and InvalidateTag publish on the
+// InvalidationBus once for all shards. Remote ShardedEngines have each of their
+// shards apply what they receive.
+func (se *ShardedEngine) Invalidate(keys ...string) {
+	for _, k := range keys {
+		e := se.shard(k)
+		e.rwm.Lock()
+		e.invalidate(k)
+		e.rwm.Unlock()
+	}
+	se.shards[0].publish(Invalidation{Keys: keys})
+}
+
+func (se *ShardedEngine) InvalidatePrefix(prefix string) int {
+	var n int
+	for _, e := range se.shards {
+		e.rwm.Lock()
+		n += e.invalidatePrefix(prefix)
+		e.rwm.Unlock()
+	}
+	se.shards[0].publish(Invalidation{Prefixes: []string{prefix}})
+	return n
+}
+
+func (se *ShardedEngine) InvalidateTag(tag string) int {
+	var n int
+	for _, e := range se.shards {
+		e.rwm.Lock()
+		n += e.invalidateTag(tag)
+		e.rwm.Unlock()
+	}
+	se.shards[0].publish(Invalidation{Tags: []string{tag}})
+	return n
+}
+
+func (se *ShardedEngine) GetTTL(keys ...string) []float64 {
+	t := make([]float64, 0, len(keys))
+	for _, k := range keys {
+		t = append(t, se.shard(k).GetTTL(k)...)
+	}
+	return t
+}
+
+// Subscribe returns a Subscription to the events of all shards.
+func (se *ShardedEngine) Subscribe(size int) *Subscription {
+	return subscribe(size, se.shards...)
+}
+
+func (se *ShardedEngine) ExpiringWithin(d time.Duration) int {
+	var n int
+	for _, e := range se.shards {
+		n += e.ExpiringWithin(d)
+	}
+	return n
+}
+
+// Stats returns the sum of the stats of all shards.
+func (se *ShardedEngine) Stats() Stats {
+	var s Stats
+	for _, e := range se.shards {
+		s.add(e.Stats())
+	}
+	return s
+}
+
+// Snapshot writes the cached values of all shards to w, in the format of
+// Engine.Snapshot but without access frequencies. Shards are snapshotted one
+// after the other rather than all at once.
+func (se *ShardedEngine) Snapshot(w io.Writer) error {
+	var (
+		entries []snapshotEntry
+		err     error
+	)
+	for _, e := range se.shards {
+		if entries, err = e.snapshotEntries(entries); err != nil {
+			return err
+		}
+	}
+	return writeSnapshot(w, nil, entries)
+}
+
+// Restore is like Engine.Restore. Access frequencies are not restored.
+func (se *ShardedEngine) Restore(r io.Reader) (int, error) {
+	return readSnapshot(r, func([]byte) {},
+		func(key string, b []byte, expiry *time.Time) error {
+			return se.shard(key).set(key, b, expiry)
+		})
+}
+
+// Close closes all shards concurrently, see Engine.Close.
+func (se *ShardedEngine) Close(ctx context.Context) error {
+	errs := make([]error, len(se.shards))
+
+	var wg sync.WaitGroup
+	for i, e := range se.shards {
+		wg.Add(1)
+		go func(i int, e *Engine) {
+			defer wg.Done()
+			errs[i] = e.Close(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
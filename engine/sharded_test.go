@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func TestShardedEngine(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	opts.MaxPayloadTotalBytes = 10*1000*1000 + 3
+
+	_, err := NewShardedEngine(&opts, 0)
+	assert.NotNil(t, err)
+
+	// too many shards for ExpectedLen
+	manyOpts := opts
+	manyOpts.ExpectedLen = 1024
+	_, err = NewShardedEngine(&manyOpts, 128)
+	assert.NotNil(t, err)
+	manyOpts.ExpectedLen = 128 * 1024
+	se, err := NewShardedEngine(&manyOpts, 128)
+	assert.Nil(t, err)
+	se.Close(context.Background())
+
+	policyOpts := opts
+	policyOpts.EvictionPolicy = NewLRUPolicy()
+	_, err = NewShardedEngine(&policyOpts, 4)
+	assert.NotNil(t, err)
+
+	policyOpts.EvictionPolicy = nil
+	policyOpts.NewEvictionPolicy = func(int64) EvictionPolicy { return NewLRUPolicy() }
+	se, err = NewShardedEngine(&policyOpts, 4)
+	assert.Nil(t, err)
+	for _, e := range se.shards {
+		assert.Nil(t, e.stats)
+	}
+	se.Close(context.Background())
+
+	se, err = NewShardedEngine(&opts, 4)
+	assert.Nil(t, err)
+	defer se.Close(context.Background())
+
+	// the budget is split without losing a byte
+	var total int64
+	for _, e := range se.shards {
+		total += e.maxPayloadTotal
+	}
+	assert.Equal(t, opts.MaxPayloadTotalBytes, total)
+	assert.Equal(t, opts.MaxPayloadTotalBytes, se.Stats().MaxPayloadBytes)
+
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		r, err := se.Get(k)
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(r)
+		assert.Equal(t, k, string(b))
+	}
+
+	// keys are spread over all shards, each key living in a single one
+	for _, e := range se.shards {
+		assert.True(t, e.Stats().Keys > 10)
+	}
+	s := se.Stats()
+	assert.Equal(t, 100, s.Keys)
+	assert.Equal(t, uint64(100), s.Misses)
+	assert.Equal(t, uint64(100), s.FillLatency.Count)
+
+	hour := time.Now().Add(time.Hour)
+	assert.Nil(t, se.Set("set", []byte("value"), &hour))
+	assert.InDelta(t, 3600, se.GetTTL("set")[0], 1)
+	se.Invalidate("set", "0")
+	assert.Equal(t, 99, se.Stats().Keys)
+
+	var buf bytes.Buffer
+	assert.Nil(t, se.Snapshot(&buf))
+	se2, err := NewShardedEngine(&opts, 3)
+	assert.Nil(t, err)
+	defer se2.Close(context.Background())
+	n, err := se2.Restore(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 99, n)
+	assert.Equal(t, 99, se2.Stats().Keys)
+
+	assert.Nil(t, se2.Close(context.Background()))
+	assert.Equal(t, ErrClosed, se2.Close(context.Background()))
+}
+
+type getSetter interface {
+	Get(key string) (*bytes.Reader, error)
+	Set(key string, value []byte, expiry *time.Time) error
+}
+
+// benchmarkParallel runs a read mostly workload over 1000 cached keys on all
+// cores, every 10th operation being a Set.
+func benchmarkParallel(b *testing.B, gs getSetter) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		gs.Get(keys[i])
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		value := []byte("value")
+		for i := 0; pb.Next(); i++ {
+			k := keys[i%len(keys)]
+			if i%10 == 0 {
+				gs.Set(k, value, nil)
+			} else {
+				gs.Get(k)
+			}
+		}
+	})
+}
+
+func BenchmarkParallelEngine(b *testing.B) {
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	e, _ := NewEngine(&opts)
+	defer e.Close(context.Background())
+
+	benchmarkParallel(b, e)
+}
+
+func BenchmarkParallelShardedEngine(b *testing.B) {
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	se, _ := NewShardedEngine(&opts, 64)
+	defer se.Close(context.Background())
+
+	benchmarkParallel(b, se)
+}
@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Snapshot format, all integers being (u)varints:
+//
+//	magic "fury" | version | flags
+//	[len | count-min-sketch]   if flags&snapshotCMS
+//	count
+//	count * (len | key | len | value | expiry in unix nanoseconds, 0 if none)
+const (
+	snapshotMagic   = "fury"
+	snapshotVersion = 1
+
+	snapshotCMS = 1 // flag
+)
+
+// ErrSnapshotFormat is returned by Restore when reading anything but a
+// snapshot written by Snapshot.
+var ErrSnapshotFormat = errors.New("invalid snapshot")
+
+type snapshotEntry struct {
+	key    string
+	b      []byte
+	expiry int64 // unix nanoseconds, 0 if none
+}
+
+// Snapshot writes all cached values to w along with their expiry and, when
+// the default eviction policy is in use, its access frequency sketch. Stale
+// rows and cached origin errors are left out.
+// Values are collected under the top level lock but written without it, so a
+// slow w only blocks the engine for as long as copying the key set takes.
+func (e *Engine) Snapshot(w io.Writer) error {
+
+	entries, err := e.snapshotEntries(nil)
+	if err != nil {
+		return err
+	}
+
+	var cms bytes.Buffer
+	if e.stats != nil {
+		e.stats.Lock()
+		_, err := e.stats.cms.WriteDataTo(&cms)
+		e.stats.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeSnapshot(w, cms.Bytes(), entries)
+}
+
+// snapshotEntries appends the fresh rows of e to entries.
+func (e *Engine) snapshotEntries(entries []snapshotEntry) ([]snapshotEntry, error) {
+	e.rwm.RLock()
+	defer e.rwm.RUnlock()
+
+	if e.closed {
+		return nil, ErrClosed
+	}
+	for k, b := range e.data {
+		if _, stale := e.stale[k]; stale {
+			continue
+		}
+		var exp int64
+		if el, ok := e.ttl.m[k]; ok {
+			exp = el.Key().UnixNano()
+		}
+		entries = append(entries, snapshotEntry{k, b, exp})
+	}
+	return entries, nil
+}
+
+// writeSnapshot writes entries and the serialized sketch cms, if any.
+func writeSnapshot(w io.Writer, cms []byte, entries []snapshotEntry) error {
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(x uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf, x)])
+	}
+
+	var flags uint64
+	if len(cms) > 0 {
+		flags |= snapshotCMS
+	}
+
+	bw.WriteString(snapshotMagic)
+	putUvarint(snapshotVersion)
+	putUvarint(flags)
+	if flags&snapshotCMS != 0 {
+		putUvarint(uint64(len(cms)))
+		bw.Write(cms)
+	}
+
+	putUvarint(uint64(len(entries)))
+	for _, en := range entries {
+		putUvarint(uint64(len(en.key)))
+		bw.WriteString(en.key)
+		putUvarint(uint64(len(en.b)))
+		bw.Write(en.b)
+		bw.Write(buf[:binary.PutVarint(buf, en.expiry)])
+	}
+
+	// bufio.Writer errors are sticky
+	return bw.Flush()
+}
+
+// Restore caches the values of a snapshot written by Snapshot, skipping those
+// which have expired in the meantime or which are larger than MaxItemBytes.
+// A frequency sketch recorded in the snapshot is only restored if the default
+// eviction policy is in use and configured the same way. Restore returns the
+// number of values cached.
+func (e *Engine) Restore(r io.Reader) (int, error) {
+
+	restoreCMS := func(cms []byte) {
+		if e.stats != nil {
+			e.stats.Lock()
+			// a mismatching configuration leaves the sketch untouched
+			_, _ = e.stats.cms.ReadDataFrom(bytes.NewReader(cms))
+			e.stats.Unlock()
+		}
+	}
+
+	return readSnapshot(r, restoreCMS, e.set)
+}
+
+// readSnapshot passes the sketch of the snapshot in r, if any, to restoreCMS
+// and then its unexpired entries to set.
+func readSnapshot(r io.Reader, restoreCMS func([]byte),
+	set func(key string, b []byte, expiry *time.Time) error) (int, error) {
+
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return 0, ErrSnapshotFormat
+	}
+
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, ErrSnapshotFormat
+	}
+	if version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	flags, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, ErrSnapshotFormat
+	}
+
+	if flags&snapshotCMS != 0 {
+		cms, err := readChunk(br)
+		if err != nil {
+			return 0, err
+		}
+		restoreCMS(cms)
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, ErrSnapshotFormat
+	}
+
+	var restored int
+	for i := uint64(0); i < count; i++ {
+
+		key, err := readChunk(br)
+		if err != nil {
+			return restored, err
+		}
+		b, err := readChunk(br)
+		if err != nil {
+			return restored, err
+		}
+		nanos, err := binary.ReadVarint(br)
+		if err != nil {
+			return restored, ErrSnapshotFormat
+		}
+
+		var expiry *time.Time
+		if nanos != 0 {
+			t := time.Unix(0, nanos)
+			if !t.After(time.Now()) {
+				continue
+			}
+			expiry = &t
+		}
+
+		switch err := set(string(key), b, expiry); err {
+		case nil:
+			restored++
+		case ErrTooLarge:
+		default:
+			return restored, err
+		}
+	}
+
+	return restored, nil
+}
+
+// readChunk reads a length prefixed byte slice.
+func readChunk(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, ErrSnapshotFormat
+	}
+
+	// grows as data arrives instead of trusting n up front
+	var b bytes.Buffer
+	if m, err := io.CopyN(&b, br, int64(n)); err != nil || uint64(m) != n {
+		return nil, ErrSnapshotFormat
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+
+	e, err := NewEngine(&testOptionsDefault)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	hour := time.Now().Add(time.Hour)
+	soon := time.Now().Add(50 * time.Millisecond)
+	assert.Nil(t, e.Set("forever", []byte("f"), nil))
+	assert.Nil(t, e.Set("hour", []byte("h"), &hour))
+	assert.Nil(t, e.Set("soon", []byte("s"), &soon))
+	for i := 0; i < 5; i++ {
+		e.Get("hour")
+	}
+	e.accesses.drain(e.stats.addBatch)
+
+	var buf bytes.Buffer
+	assert.Nil(t, e.Snapshot(&buf))
+	snapshot := buf.Bytes()
+
+	time.Sleep(60 * time.Millisecond)
+
+	e2, err := NewEngine(&testOptionsDefault)
+	assert.Nil(t, err)
+	defer e2.Close(context.Background())
+
+	n, err := e2.Restore(bytes.NewReader(snapshot))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	r := e2.tryget("forever")
+	assert.NotNil(t, r)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "f", string(b))
+	assert.NotNil(t, e2.tryget("hour"))
+	assert.Nil(t, e2.tryget("soon"))
+
+	ttl := e2.GetTTL("forever", "hour")
+	assert.True(t, ttl[0] < 0)
+	assert.InDelta(t, 3600, ttl[1], 1)
+
+	assert.Equal(t, uint64(5), e2.stats.cms.Count([]byte("hour")))
+
+	// corrupt snapshots
+	_, err = e2.Restore(bytes.NewReader([]byte("not a snapshot")))
+	assert.Equal(t, ErrSnapshotFormat, err)
+
+	_, err = e2.Restore(bytes.NewReader(snapshot[:len(snapshot)-3]))
+	assert.Equal(t, ErrSnapshotFormat, err)
+
+	e.Close(context.Background())
+	assert.Equal(t, ErrClosed, e.Snapshot(&buf))
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// staleRow is an expired row still kept around within its grace periods.
+type staleRow struct {
+	expiredAt        time.Time
+	revalidateBefore time.Time // served while refreshed in the background
+	ifErrorBefore    time.Time // served in place of a failed refresh
+	refreshFailed    bool
+}
+
+func (sr *staleRow) servable(now time.Time) bool {
+	return now.Before(sr.revalidateBefore) ||
+		(sr.refreshFailed && now.Before(sr.ifErrorBefore))
+}
+
+type staleness struct {
+	whileRevalidate time.Duration
+	ifError         time.Duration
+}
+
+func stalenessOf(st Staler) staleness {
+	wr, ie := st.Stale()
+	return staleness{wr, ie}
+}
+
+func (e *Engine) gracePeriods(key string) staleness {
+	g := e.grace[key]
+	if g.whileRevalidate == 0 {
+		g.whileRevalidate = e.staleWhileRevalidate
+	}
+	if g.ifError == 0 {
+		g.ifError = e.staleIfError
+	}
+	return g
+}
+
+// expire deletes key, unless it has a grace period in which case it's kept as
+// stale until the grace period is over. Keys with a validator are kept as
+// stale past their grace periods, though not servable, until evicted so that
+// they can be revalidated.
+// Cached errors are simply forgotten.
+// still holding top level lock
+func (e *Engine) expire(key string, expiredAt time.Time) {
+
+	if _, ok := e.negative[key]; ok {
+		delete(e.negative, key)
+		e.ttl.delTTLEntry(key)
+		return
+	}
+
+	_, stale := e.stale[key]
+	_, ok := e.data[key]
+	if ok && !stale {
+		atomic.AddUint64(&e.counters.expirations, 1)
+	}
+
+	if g := e.gracePeriods(key); ok && !stale &&
+		(g.whileRevalidate > 0 || g.ifError > 0) {
+
+		e.stale[key] = &staleRow{
+			expiredAt,
+			expiredAt.Add(g.whileRevalidate),
+			expiredAt.Add(g.ifError),
+			false,
+		}
+
+		graceOver := expiredAt.Add(g.whileRevalidate)
+		if g.ifError > g.whileRevalidate {
+			graceOver = expiredAt.Add(g.ifError)
+		}
+		e.setExpiry(key, graceOver)
+
+		return
+	}
+
+	if _, ok := e.validators[key]; ok {
+		e.stale[key] = &staleRow{expiredAt: expiredAt}
+		e.ttl.delTTLEntry(key)
+		return
+	}
+
+	e.delDataTTLStats(key, Expired)
+}
+
+// staleFallback returns the value of key if it's stale but may be served in
+// place of a failed refresh.
+// still holding top level lock
+func (e *Engine) staleFallback(key string) ([]byte, bool) {
+	if sr, ok := e.stale[key]; ok && time.Now().Before(sr.ifErrorBefore) {
+		b, ok := e.data[key]
+		return b, ok
+	}
+	return nil, false
+}
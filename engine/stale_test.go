@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+
+	o := &testdummies.FlakyOrigin{TTL: 20 * time.Millisecond}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	opts.StaleWhileRevalidate = 50 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, o.Fetches())
+
+	// expired, waiting on the TTL loop rather than for a fixed time
+	assert.Eventually(t, isStale(e, "a"), time.Second, time.Millisecond)
+	assert.True(t, e.GetTTL("a")[0] < 0)
+
+	// served stale, one background refresh for all
+	o.SetFailing(true)
+	for i := 0; i < 10; i++ {
+		r, err := e.Get("a")
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "a", string(b))
+	}
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, o.Fetches() < 5)
+
+	// refreshed
+	o.SetFailing(false)
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return !isStale(e, "a")() },
+		time.Second, time.Millisecond)
+	assert.True(t, e.GetTTL("a")[0] > 0)
+
+	// grace period over
+	assert.Eventually(t, func() bool {
+		e.rwm.RLock()
+		defer e.rwm.RUnlock()
+		_, ok := e.data["a"]
+		return !ok
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, e.tryget("a"))
+}
+
+func isStale(e *Engine, key string) func() bool {
+	return func() bool {
+		e.rwm.RLock()
+		defer e.rwm.RUnlock()
+		_, stale := e.stale[key]
+		return stale
+	}
+}
+
+func TestStaleIfError(t *testing.T) {
+
+	// per key grace periods override the engine's (none here)
+	o := &testdummies.FlakyOrigin{
+		TTL:     20 * time.Millisecond,
+		IfError: 60 * time.Millisecond,
+	}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+
+	assert.Eventually(t, isStale(e, "a"), time.Second, time.Millisecond)
+	o.SetFailing(true)
+
+	// refresh blocks, but falls back to the stale copy
+	r, err := e.Get("a")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "a", string(b))
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+
+	// stale-if-error period over
+	time.Sleep(60 * time.Millisecond)
+	_, err = e.Get("a")
+	assert.NotNil(t, err)
+}
+
+func TestStaleIfErrorStream(t *testing.T) {
+
+	o := &testdummies.FlakyOrigin{
+		TTL:     20 * time.Millisecond,
+		IfError: 60 * time.Millisecond,
+	}
+	opts := testOptionsDefault
+	opts.O = o
+	opts.TTLTickStep = 1 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+
+	assert.Eventually(t, isStale(e, "a"), time.Second, time.Millisecond)
+	o.SetFailing(true)
+
+	// the refresh fails before streaming anything, the stale copy is read
+	rc, err := e.GetStream(context.Background(), "a")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(b))
+	rc.Close()
+
+	// stale-if-error period over
+	time.Sleep(60 * time.Millisecond)
+	rc, err = e.GetStream(context.Background(), "a")
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(rc)
+	assert.NotNil(t, err)
+	rc.Close()
+}
+
+// versionOrigin answers after delay with "v1", "v2"... expiring after ttl.
+type versionOrigin struct {
+	delay, ttl time.Duration
+	version    int32
+}
+
+func (vo *versionOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	time.Sleep(vo.delay)
+	v := "v" + strconv.Itoa(int(atomic.AddInt32(&vo.version, 1)))
+	exp := time.Now().Add(vo.ttl)
+	return ioutil.NopCloser(bytes.NewReader([]byte(v))), &exp, nil
+}
+
+func TestJoinBackgroundRefresh(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &versionOrigin{delay: 200 * time.Millisecond, ttl: 50 * time.Millisecond}
+	opts.TTLTickStep = 1 * time.Millisecond
+	opts.StaleWhileRevalidate = 50 * time.Millisecond
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	get := func() string {
+		r, err := e.Get("a")
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(r)
+		return string(b)
+	}
+	gone := func() bool {
+		e.rwm.RLock()
+		defer e.rwm.RUnlock()
+		_, ok := e.data["a"]
+		return !ok
+	}
+
+	assert.Equal(t, "v1", get())
+
+	// served stale while refreshed in the background
+	assert.Eventually(t, isStale(e, "a"), time.Second, time.Millisecond)
+	assert.Equal(t, "v1", get())
+
+	// grace period over well before the refresh is, which is joined
+	assert.Eventually(t, gone, time.Second, time.Millisecond)
+	assert.Equal(t, "v2", get())
+	e.rwm.RLock()
+	_, ok := e.fillCond["a"]
+	e.rwm.RUnlock()
+	assert.False(t, ok)
+
+	// v2 gone as well, fetched anew rather than served from the finished fill
+	assert.Eventually(t, gone, time.Second, time.Millisecond)
+	assert.Equal(t, "v3", get())
+}
@@ -11,6 +11,7 @@ import (
 
 // accessStats approximates the access statistics of all keys not yet evicted
 // (even this is approximate, i.e. eventually consistent with the cache's state).
+// It's the default EvictionPolicy.
 type accessStats struct {
 	sync.Mutex
 	cms               *boom.CountMinSketch
@@ -32,6 +33,21 @@ func (as *accessStats) addToWindow(key string) {
 	as.Lock()
 	defer as.Unlock()
 
+	as.add(key)
+}
+
+// addBatch is addToWindow for several keys at once.
+func (as *accessStats) addBatch(keys []string) {
+	as.Lock()
+	defer as.Unlock()
+
+	for _, key := range keys {
+		as.add(key)
+	}
+}
+
+// still holding lock
+func (as *accessStats) add(key string) {
 	as.cms.Add([]byte(key))
 
 	as.delRelevant(key)
@@ -52,6 +68,55 @@ func (as *accessStats) updateDataDeletion(key string) {
 	as.delIrrelevant(key)
 }
 
+func (as *accessStats) OnAccess(key string) {
+	as.addToWindow(key)
+}
+
+// OnInsert makes sure a key which got into the cache without being accessed
+// (i.e. by Set) can be evicted.
+func (as *accessStats) OnInsert(key string, _ int) {
+	as.Lock()
+	defer as.Unlock()
+
+	_, relevant := as.relevantMap[key]
+	_, irrelevant := as.irrelevantMap[key]
+	if !relevant && !irrelevant {
+		dlAdd := as.relevantDuplist.Insert(as.cms.Count([]byte(key)), key)
+		llAdd := as.relevantLL.AddToBack(key)
+		as.relevantMap[key] = relevantTuple{dlAdd, llAdd}
+	}
+}
+
+func (as *accessStats) OnDelete(key string) {
+	as.updateDataDeletion(key)
+}
+
+// Victims yields irrelevant keys before relevant ones, the least frequently
+// accessed first.
+func (as *accessStats) Victims(yield func(key string) bool) {
+	as.Lock()
+	defer as.Unlock()
+
+	for it := as.irrelevantDuplist.First(); it != nil; it = it.Next() {
+		if !yield(it.Val()) {
+			return
+		}
+	}
+
+	for it := as.relevantDuplist.First(); it != nil; it = it.Next() {
+		if !yield(it.Val()) {
+			return
+		}
+	}
+}
+
+// relevantLocked reports whether key was accessed within the relevance
+// window. The caller already holds the lock, e.g. within Victims.
+func (as *accessStats) relevantLocked(key string) bool {
+	_, ok := as.relevantMap[key]
+	return ok
+}
+
 func (as *accessStats) delRelevant(key string) {
 	if tup, ok := as.relevantMap[key]; ok {
 		as.relevantLL.Del(tup.llPtr)
@@ -67,8 +132,32 @@ func (as *accessStats) delIrrelevant(key string) {
 	}
 }
 
-func (as *accessStats) startLoop(step time.Duration) {
-	for range time.Tick(step) {
+// returns once done is closed. Also drains accesses, if not nil.
+func (as *accessStats) startLoop(step time.Duration, done <-chan struct{},
+	accesses *accessBuffer) {
+
+	var batches <-chan []string
+	if accesses != nil {
+		batches = accesses.batches
+	}
+
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case batch := <-batches:
+			as.addBatch(batch)
+			continue
+		case <-ticker.C:
+		}
+
+		if accesses != nil {
+			accesses.drain(as.addBatch)
+		}
+
 		as.Lock()
 		for it := as.relevantLL.Front(); it != nil &&
 			it.LastAccessed().Add(as.relevanceWindow).Before(time.Now()); it = it.Next() {
@@ -60,7 +60,9 @@ func TestAccessStats(t *testing.T) {
 
 	as.Unlock()
 
-	go as.startLoop(time.Millisecond)
+	done := make(chan struct{})
+	defer close(done)
+	go as.startLoop(time.Millisecond, done, nil)
 
 	time.Sleep(30 * time.Millisecond)
 
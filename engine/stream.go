@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// GetStream is like GetContext, except that on a cache miss it does not wait
+// for the cache fill to complete. The returned reader yields the value as it
+// arrives from the origin, and returns the fill's error (if any) once all
+// bytes received before the failure have been read, or falls back to a stale
+// value like Get if none were. Concurrent callers of GetStream and Get for the
+// same key share one fill.
+// The returned reader must be closed, and Read returns ctx.Err() once ctx is
+// done.
+func (e *Engine) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.accesses.record(key)
+
+	r, err := e.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil { // cache hit
+		return ioutil.NopCloser(r), nil
+	}
+
+	// cache miss
+	e.rwm.Lock()
+	defer e.rwm.Unlock()
+
+	b, c, err := e.acquire(ctx, key, e.startFill)
+	if c == nil {
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	return newStreamReader(ctx, key, c, e), nil
+}
+
+// streamBuffer is the growing buffer of a cache fill, readable while it's
+// still being written to.
+type streamBuffer struct {
+	sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	done bool
+	err  error
+}
+
+// errResolved is returned by the writes to a streamBuffer which was resolved
+// in place of its fill.
+var errResolved = errors.New("cache fill resolved by Set")
+
+func newStreamBuffer() *streamBuffer {
+	sb := &streamBuffer{}
+	sb.cond = sync.NewCond(sb)
+	return sb
+}
+
+func (sb *streamBuffer) Write(p []byte) (int, error) {
+	sb.Lock()
+	defer sb.Unlock()
+
+	if sb.done {
+		return 0, errResolved
+	}
+
+	sb.buf = append(sb.buf, p...)
+	sb.cond.Broadcast()
+
+	return len(p), nil
+}
+
+// nil if nothing was written.
+func (sb *streamBuffer) bytes() []byte {
+	sb.Lock()
+	defer sb.Unlock()
+
+	return sb.buf
+}
+
+// finish is a no-op once sb was resolved.
+func (sb *streamBuffer) finish(err error) {
+	sb.Lock()
+	defer sb.Unlock()
+
+	if sb.done {
+		return
+	}
+	sb.done = true
+	sb.err = err
+	sb.cond.Broadcast()
+}
+
+// resolve completes sb with b in place of whatever the fill would have
+// written, unless some of it has already been written and may have been
+// streamed.
+func (sb *streamBuffer) resolve(b []byte) bool {
+	sb.Lock()
+	defer sb.Unlock()
+
+	if sb.buf != nil || sb.done {
+		return false
+	}
+	sb.buf = b
+	sb.done = true
+	sb.cond.Broadcast()
+	return true
+}
+
+type streamReader struct {
+	ctx   context.Context
+	key   string
+	c     *condition
+	e     *Engine
+	off   int
+	stop  chan struct{}
+	once  sync.Once
+	stale *bytes.Reader // in place of a failed fill
+}
+
+// still holding top level lock
+func newStreamReader(ctx context.Context, key string, c *condition, e *Engine) *streamReader {
+
+	sr := &streamReader{ctx, key, c, e, 0, make(chan struct{}), sync.Once{}, nil}
+
+	if done := ctx.Done(); done != nil {
+		go func() {
+			select {
+			case <-done: // wake up Read
+				sr.c.sb.Lock()
+				sr.c.sb.cond.Broadcast()
+				sr.c.sb.Unlock()
+			case <-sr.stop:
+			}
+		}()
+	}
+
+	return sr
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	if sr.stale != nil {
+		return sr.stale.Read(p)
+	}
+
+	n, err := sr.read(p)
+	if err == nil || err == io.EOF || sr.off > 0 || sr.ctx.Err() != nil {
+		return n, err
+	}
+
+	// the fill failed before anything was read, outside of sb's lock which
+	// is taken under the top level one
+	sr.e.rwm.RLock()
+	b, ok := sr.e.staleFallback(sr.key)
+	sr.e.rwm.RUnlock()
+	if !ok {
+		return 0, err
+	}
+	sr.stale = bytes.NewReader(b)
+	return sr.stale.Read(p)
+}
+
+func (sr *streamReader) read(p []byte) (int, error) {
+	sb := sr.c.sb
+	sb.Lock()
+	defer sb.Unlock()
+
+	for sr.off >= len(sb.buf) && !sb.done && sr.ctx.Err() == nil {
+		sb.cond.Wait()
+	}
+
+	if sr.off < len(sb.buf) {
+		n := copy(p, sb.buf[sr.off:])
+		sr.off += n
+		return n, nil
+	}
+
+	if sb.err != nil {
+		return 0, sb.err
+	}
+
+	if !sb.done {
+		return 0, sr.ctx.Err()
+	}
+
+	return 0, io.EOF
+}
+
+// Close drops the reader's interest in the cache fill, which is abandoned if
+// nobody else waits for it.
+func (sr *streamReader) Close() error {
+	sr.once.Do(func() {
+		close(sr.stop)
+		sr.e.rwm.Lock()
+		sr.e.release(sr.key, sr.c)
+		sr.e.rwm.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func TestGetStream(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.ChunkedOrigin{Delay: 10 * time.Millisecond}
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	start := time.Now()
+	rc, err := e.GetStream(context.Background(), "abc")
+	assert.Nil(t, err)
+
+	p := make([]byte, 3)
+	n, err := rc.Read(p)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(p[:n]))
+	assert.True(t, time.Since(start) < 50*time.Millisecond,
+		"first bytes must arrive before the fill is done")
+
+	// coalesced waiters, both streaming and blocking
+	rc2, err := e.GetStream(context.Background(), "abc")
+	assert.Nil(t, err)
+	r, err := e.Get("abc")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, strings.Repeat("abc", 10), string(b))
+
+	b, err = ioutil.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("abc", 9), string(b))
+	b, err = ioutil.ReadAll(rc2)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("abc", 10), string(b))
+	assert.Nil(t, rc.Close())
+	assert.Nil(t, rc2.Close())
+
+	// committed, without the spare capacity of the stream buffer
+	assert.NotNil(t, e.tryget("abc"))
+	e.rwm.RLock()
+	assert.Equal(t, len(e.data["abc"]), cap(e.data["abc"]))
+	e.rwm.RUnlock()
+	rc, err = e.GetStream(context.Background(), "abc")
+	assert.Nil(t, err)
+	b, _ = ioutil.ReadAll(rc)
+	assert.Equal(t, strings.Repeat("abc", 10), string(b))
+
+	// error midway
+	rc, err = e.GetStream(context.Background(), "fail")
+	assert.Nil(t, err)
+	b, err = ioutil.ReadAll(rc)
+	assert.Equal(t, "fake error midway", err.Error())
+	assert.Equal(t, strings.Repeat("fail", 5), string(b))
+	assert.Nil(t, rc.Close())
+	assert.Nil(t, e.tryget("fail"))
+
+	// cancelled reader
+	ctx, cancel := context.WithCancel(context.Background())
+	rc, err = e.GetStream(ctx, "xyz")
+	assert.Nil(t, err)
+	cancel()
+	_, err = ioutil.ReadAll(rc)
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, rc.Close())
+
+	e.rwm.RLock()
+	assert.Equal(t, 0, len(e.fillCond))
+	e.rwm.RUnlock()
+}
+
+func TestGetStreamSet(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.ChunkedOrigin{Delay: 10 * time.Millisecond}
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	// nothing streamed yet, handed the pushed value
+	rc, err := e.GetStream(context.Background(), "abc")
+	assert.Nil(t, err)
+	assert.Nil(t, e.Set("abc", []byte("pushed"), nil))
+	b, err := ioutil.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, "pushed", string(b))
+	assert.Nil(t, rc.Close())
+
+	// part way through, the origin's value is streamed to the end
+	rc, err = e.GetStream(context.Background(), "xyz")
+	assert.Nil(t, err)
+	p := make([]byte, 3)
+	_, err = rc.Read(p)
+	assert.Nil(t, err)
+	assert.Nil(t, e.Set("xyz", []byte("pushed"), nil))
+	b, err = ioutil.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("xyz", 9), string(b))
+	assert.Nil(t, rc.Close())
+
+	// the pushed value is the one cached either way
+	for _, k := range []string{"abc", "xyz"} {
+		r, err := e.Get(k)
+		assert.Nil(t, err)
+		b, _ = ioutil.ReadAll(r)
+		assert.Equal(t, "pushed", string(b))
+	}
+}
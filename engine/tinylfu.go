@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"container/list"
+	"sync"
+
+	boom "github.com/tylertreat/BoomFilters"
+)
+
+const (
+	tinyLFUWindow = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+type tinyLFUEntry struct {
+	key     string
+	segment int
+}
+
+type wTinyLFUPolicy struct {
+	sync.Mutex
+	sketch     *boom.CountMinSketch
+	added      uint64
+	sampleSize uint64
+	segments   [3]*list.List // window, probation, protected; MRU at the front
+	m          map[string]*list.Element
+}
+
+// NewWTinyLFUPolicy returns a W-TinyLFU EvictionPolicy. New keys enter a small
+// LRU window (1% of the keys), and once evicted from it, have to beat the
+// access frequency of the main segmented LRU's victim to stay in the cache.
+// Frequencies are estimated by a count-min sketch which is reset every
+// 10*expectedLen accesses, expectedLen having the same meaning as in Options.
+func NewWTinyLFUPolicy(expectedLen int64) EvictionPolicy {
+	return &wTinyLFUPolicy{
+		sketch:     boom.NewCountMinSketch(0.001, 0.99),
+		sampleSize: 10 * uint64(expectedLen),
+		segments:   [3]*list.List{list.New(), list.New(), list.New()},
+		m:          make(map[string]*list.Element),
+	}
+}
+
+func (tl *wTinyLFUPolicy) OnAccess(key string) {
+	tl.Lock()
+	defer tl.Unlock()
+
+	tl.sketch.Add([]byte(key))
+	if tl.added++; tl.added >= tl.sampleSize {
+		tl.sketch.Reset()
+		tl.added = 0
+	}
+
+	if el, ok := tl.m[key]; ok {
+		tl.touch(el)
+	}
+}
+
+func (tl *wTinyLFUPolicy) OnInsert(key string, _ int) {
+	tl.Lock()
+	defer tl.Unlock()
+
+	if el, ok := tl.m[key]; ok {
+		tl.touch(el)
+		return
+	}
+
+	tl.m[key] = tl.segments[tinyLFUWindow].PushFront(&tinyLFUEntry{key, tinyLFUWindow})
+
+	// window overflow moves on to probation
+	if window := tl.segments[tinyLFUWindow]; window.Len() > tl.windowCap() {
+		tl.move(window.Back(), tinyLFUProbation)
+	}
+}
+
+func (tl *wTinyLFUPolicy) OnDelete(key string) {
+	tl.Lock()
+	defer tl.Unlock()
+
+	if el, ok := tl.m[key]; ok {
+		tl.segments[el.Value.(*tinyLFUEntry).segment].Remove(el)
+		delete(tl.m, key)
+	}
+}
+
+// Victims makes the window's LRU key and the main segment's LRU key duel on
+// their frequencies. The loser is evicted, a winning window key moves on to
+// the main segment.
+func (tl *wTinyLFUPolicy) Victims(yield func(key string) bool) {
+	tl.Lock()
+	defer tl.Unlock()
+
+	for {
+		candidate := tl.segments[tinyLFUWindow].Back()
+		victim := tl.segments[tinyLFUProbation].Back()
+		if victim == nil {
+			victim = tl.segments[tinyLFUProtected].Back()
+		}
+
+		switch {
+		case candidate == nil && victim == nil:
+			return
+
+		case victim == nil:
+			victim = candidate
+
+		case candidate != nil && tl.freq(candidate) <= tl.freq(victim):
+			victim = candidate
+
+		case candidate != nil: // admitted
+			tl.move(candidate, tinyLFUProbation)
+		}
+
+		entry := victim.Value.(*tinyLFUEntry)
+		tl.segments[entry.segment].Remove(victim)
+		delete(tl.m, entry.key)
+
+		if !yield(entry.key) {
+			return
+		}
+	}
+}
+
+// touch promotes el within the segmented LRU.
+func (tl *wTinyLFUPolicy) touch(el *list.Element) {
+	switch el.Value.(*tinyLFUEntry).segment {
+
+	case tinyLFUProbation:
+		tl.move(el, tinyLFUProtected)
+
+		// protected overflow is demoted back to probation
+		protected := tl.segments[tinyLFUProtected]
+		if max := (len(tl.m) - tl.windowCap()) * 8 / 10; protected.Len() > max && max > 0 {
+			tl.move(protected.Back(), tinyLFUProbation)
+		}
+
+	default:
+		tl.segments[el.Value.(*tinyLFUEntry).segment].MoveToFront(el)
+	}
+}
+
+func (tl *wTinyLFUPolicy) move(el *list.Element, segment int) {
+	entry := el.Value.(*tinyLFUEntry)
+	tl.segments[entry.segment].Remove(el)
+	entry.segment = segment
+	tl.m[entry.key] = tl.segments[segment].PushFront(entry)
+}
+
+func (tl *wTinyLFUPolicy) windowCap() int {
+	if n := len(tl.m) / 100; n > 1 {
+		return n
+	}
+	return 1
+}
+
+func (tl *wTinyLFUPolicy) freq(el *list.Element) uint64 {
+	return tl.sketch.Count([]byte(el.Value.(*tinyLFUEntry).key))
+}
@@ -1,44 +1,250 @@
 package engine
 
 import (
+	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/wv0m56/fury/datastructure/duplist"
+	"github.com/wv0m56/fury/datastructure/lockfree"
+	"github.com/wv0m56/fury/datastructure/timingwheel"
+)
+
+// TTLIndex selects the data structure ordering keys by expiry.
+type TTLIndex int
+
+const (
+	// SkiplistTTL is a skiplist guarded by the top level lock.
+	SkiplistTTL TTLIndex = iota
+
+	// LockFreeTTL is a lock-free skiplist, from which the TTL loop pops
+	// expired keys without taking the top level lock, only taking it to
+	// delete their values. Inserts and deletes are slower.
+	LockFreeTTL
+
+	// TimingWheelTTL is a hierarchical timing wheel guarded by the top level
+	// lock, with O(1) inserts, deletes and expiry. Keys expire up to one
+	// TTLTickStep late.
+	TimingWheelTTL
 )
 
 type ttlControl struct {
-	duplist.TimeString
-	m map[string]*duplist.TimeStringElement
+	ttlIndex
+	m map[string]ttlEntry
 	e *Engine
 }
 
-// to be invoked as a goroutine e.g. go startLoop()
-func (tc *ttlControl) startLoop(step time.Duration) {
+type ttlEntry interface {
+	Key() time.Time // expiry
+	Val() string    // key
+}
+
+// ttlIndex orders keys by expiry. Its methods are called with the top level
+// lock held, but for due and expire if concurrent returns true.
+type ttlIndex interface {
+	insert(expiry time.Time, key string) ttlEntry
+	del(el ttlEntry)
+
+	// due reports whether entries expired by now.
+	due(now time.Time) bool
+
+	// expire removes the entries expired by now, calling fn with each of them.
+	// fn may insert and delete entries.
+	expire(now time.Time, fn func(el ttlEntry))
+
+	// ascend calls yield with the entries expiring before hi, in order of
+	// expiry, until yield returns false.
+	ascend(hi time.Time, yield func(el ttlEntry) bool)
+
+	concurrent() bool
+}
+
+func newTTLIndex(kind TTLIndex, maxHeight int, src rand.Source,
+	tick time.Duration) ttlIndex {
+
+	switch kind {
+	case LockFreeTTL:
+		return lockFreeTTL{lockfree.NewTimeStringWithSource(maxHeight, src)}
+	case TimingWheelTTL:
+		return timingWheelTTL{timingwheel.New(tick, time.Now())}
+	}
+	return skiplistTTL{duplist.NewTimeStringWithSource(maxHeight, src)}
+}
+
+type skiplistTTL struct {
+	*duplist.TimeString
+}
+
+func (st skiplistTTL) insert(expiry time.Time, key string) ttlEntry {
+	return st.Insert(expiry, key)
+}
+
+func (st skiplistTTL) del(el ttlEntry) {
+	st.DelElement(el.(*duplist.TimeStringElement))
+}
+
+func (st skiplistTTL) due(now time.Time) bool {
+	f := st.First()
+	return f != nil && now.After(f.Key())
+}
+
+func (st skiplistTTL) expire(now time.Time, fn func(ttlEntry)) {
+	for f := st.First(); f != nil && now.After(f.Key()); f = st.First() {
+		st.DelElement(f)
+		fn(f)
+	}
+}
+
+func (st skiplistTTL) ascend(hi time.Time, yield func(ttlEntry) bool) {
+	st.Range(time.Time{}, hi, func(el *duplist.TimeStringElement) bool {
+		return yield(el)
+	})
+}
+
+func (skiplistTTL) concurrent() bool { return false }
+
+type lockFreeTTL struct {
+	*lockfree.TimeString
+}
+
+func (lt lockFreeTTL) insert(expiry time.Time, key string) ttlEntry {
+	return lt.Insert(expiry, key)
+}
+
+func (lt lockFreeTTL) del(el ttlEntry) {
+	lt.DelElement(el.(*lockfree.TimeStringElement))
+}
+
+func (lt lockFreeTTL) due(now time.Time) bool {
+	f := lt.First()
+	return f != nil && now.After(f.Key())
+}
+
+func (lt lockFreeTTL) expire(now time.Time, fn func(ttlEntry)) {
+	for f := lt.First(); f != nil && now.After(f.Key()); f = lt.First() {
+		lt.DelElement(f)
+		fn(f)
+	}
+}
+
+func (lt lockFreeTTL) ascend(hi time.Time, yield func(ttlEntry) bool) {
+	for it := lt.First(); it != nil && it.Key().Before(hi); it = it.Next() {
+		if !yield(it) {
+			return
+		}
+	}
+}
+
+func (lockFreeTTL) concurrent() bool { return true }
+
+type timingWheelTTL struct {
+	*timingwheel.Wheel
+}
+
+func (tw timingWheelTTL) insert(expiry time.Time, key string) ttlEntry {
+	return tw.Insert(expiry, key)
+}
+
+func (tw timingWheelTTL) del(el ttlEntry) {
+	tw.DelElement(el.(*timingwheel.Entry))
+}
+
+func (tw timingWheelTTL) due(now time.Time) bool {
+	return tw.Due(now)
+}
+
+func (tw timingWheelTTL) expire(now time.Time, fn func(ttlEntry)) {
+	tw.Advance(now, func(el *timingwheel.Entry) {
+		fn(el)
+	})
+}
+
+// ascend sorts the entries expiring before hi, the wheel keeping no order
+// within slots.
+func (tw timingWheelTTL) ascend(hi time.Time, yield func(ttlEntry) bool) {
+	var els []*timingwheel.Entry
+	tw.Each(func(el *timingwheel.Entry) bool {
+		if el.Key().Before(hi) {
+			els = append(els, el)
+		}
+		return true
+	})
+	sort.Slice(els, func(i, j int) bool {
+		return els[i].Key().Before(els[j].Key())
+	})
+	for _, el := range els {
+		if !yield(el) {
+			return
+		}
+	}
+}
+
+func (timingWheelTTL) concurrent() bool { return false }
 
-	for range time.Tick(step) {
+// to be invoked as a goroutine e.g. go startLoop(), returns once done is closed
+func (tc *ttlControl) startLoop(step time.Duration, done <-chan struct{}) {
+
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
 
-		var somethingExpired bool
 		now := time.Now()
 
-		tc.e.rwm.RLock()
-		if f := tc.First(); f != nil && now.After(f.Key()) {
-			somethingExpired = true
+		if tc.concurrent() {
+			tc.expireConcurrently(now)
+			continue
 		}
+
+		tc.e.rwm.RLock()
+		somethingExpired := tc.due(now)
 		tc.e.rwm.RUnlock()
 
 		if somethingExpired {
 			tc.e.rwm.Lock()
-			for f := tc.First(); f != nil && now.After(f.Key()); f = tc.First() {
-				tc.e.delDataTTLStats(f.Val())
-			}
+			tc.expire(now, func(el ttlEntry) {
+				if tc.m[el.Val()] == el {
+					delete(tc.m, el.Val())
+				}
+				tc.e.expire(el.Val(), el.Key())
+			})
 			tc.e.rwm.Unlock()
 		}
 	}
 }
 
+// expireConcurrently pops the entries expired by now without the top level
+// lock, then takes it to expire their keys. Keys whose expiry was set anew or
+// deleted in the meantime are left alone.
+func (tc *ttlControl) expireConcurrently(now time.Time) {
+	if !tc.due(now) {
+		return
+	}
+
+	var expired []ttlEntry
+	tc.expire(now, func(el ttlEntry) {
+		expired = append(expired, el)
+	})
+
+	tc.e.rwm.Lock()
+	defer tc.e.rwm.Unlock()
+
+	for _, el := range expired {
+		if tc.m[el.Val()] == el {
+			delete(tc.m, el.Val())
+			tc.e.expire(el.Val(), el.Key())
+		}
+	}
+}
+
 func (tc *ttlControl) delTTLEntry(key string) {
 	if el, ok := tc.m[key]; ok {
-		tc.DelElement(el)
+		tc.del(el)
 		delete(tc.m, key)
 	}
 }
@@ -46,15 +252,16 @@ func (tc *ttlControl) delTTLEntry(key string) {
 func (e *Engine) setExpiry(key string, expiry time.Time) {
 
 	if de, ok := e.ttl.m[key]; ok {
-		e.ttl.DelElement(de)
+		e.ttl.del(de)
 	}
-	insertedTTL := e.ttl.Insert(expiry, key)
+	insertedTTL := e.ttl.insert(expiry, key)
 	e.ttl.m[key] = insertedTTL
 }
 
 // GetTTL returns the number of seconds left until expiry for the given keys, in
 // the order in which keys are passed into args.
-// Keys without TTL yields negative values.
+// Keys without TTL yields negative values, as do expired keys still being
+// served stale. Cached origin errors have no TTL, their keys having no value.
 func (e *Engine) GetTTL(keys ...string) []float64 {
 	e.rwm.RLock()
 	defer e.rwm.RUnlock()
@@ -63,7 +270,10 @@ func (e *Engine) GetTTL(keys ...string) []float64 {
 	now := time.Now()
 	for _, k := range keys {
 		d, ok := e.ttl.m[k]
-		if ok {
+		_, negative := e.negative[k]
+		if sr, stale := e.stale[k]; stale {
+			t = append(t, sr.expiredAt.Sub(now).Seconds())
+		} else if ok && !negative {
 			t = append(t, d.Key().Sub(now).Seconds())
 		} else {
 			t = append(t, -1)
@@ -71,3 +281,21 @@ func (e *Engine) GetTTL(keys ...string) []float64 {
 	}
 	return t
 }
+
+// ExpiringWithin returns the number of keys which expire within d, stale rows
+// and cached origin errors excepted.
+func (e *Engine) ExpiringWithin(d time.Duration) int {
+	e.rwm.RLock()
+	defer e.rwm.RUnlock()
+
+	var n int
+	e.ttl.ascend(time.Now().Add(d), func(el ttlEntry) bool {
+		_, stale := e.stale[el.Val()]
+		_, negative := e.negative[el.Val()]
+		if !stale && !negative {
+			n++
+		}
+		return true
+	})
+	return n
+}
@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"context"
+	"math/rand"
+	"strconv"
 	"testing"
 	"time"
 
@@ -95,3 +98,141 @@ func roughly(a, b float64) bool {
 	}
 	return false
 }
+
+func TestExpiringWithin(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.O = &testdummies.NoDelayOrigin{}
+	opts.StaleWhileRevalidate = time.Hour
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	now := time.Now()
+	for i, d := range []time.Duration{time.Second, 30 * time.Second, 59 * time.Second, time.Hour} {
+		exp := now.Add(d)
+		assert.Nil(t, e.Set(string(rune('a'+i)), []byte("x"), &exp))
+	}
+	assert.Nil(t, e.Set("forever", []byte("x"), nil))
+
+	assert.Equal(t, 0, e.ExpiringWithin(0))
+	assert.Equal(t, 1, e.ExpiringWithin(2*time.Second))
+	assert.Equal(t, 3, e.ExpiringWithin(time.Minute))
+	assert.Equal(t, 4, e.ExpiringWithin(24*time.Hour))
+
+	// stale rows are kept with the expiry of their grace period
+	e.rwm.Lock()
+	e.expire("a", now)
+	e.rwm.Unlock()
+	assert.Equal(t, 3, e.ExpiringWithin(24*time.Hour))
+}
+
+func TestTTLIndexes(t *testing.T) {
+
+	for _, index := range []TTLIndex{SkiplistTTL, LockFreeTTL, TimingWheelTTL} {
+		opts := testOptionsDefault
+		opts.O = &testdummies.NoDelayOrigin{}
+		opts.TTLTickStep = 1 * time.Millisecond
+		opts.TTLIndex = index
+		e, err := NewEngine(&opts)
+		assert.Nil(t, err)
+
+		now := time.Now()
+		for i, d := range []time.Duration{40, 10, 20, 1000, 30} {
+			exp := now.Add(d * time.Millisecond)
+			assert.Nil(t, e.Set(string(rune('a'+i)), []byte("x"), &exp))
+		}
+		exp := now.Add(time.Hour)
+		assert.Nil(t, e.Set("c", []byte("x"), &exp)) // replaced
+		assert.Equal(t, 5, e.Stats().TTLKeys)
+
+		// a, b and e expired, waiting on the TTL loop rather than for a fixed time
+		assert.Eventually(t, func() bool {
+			e.rwm.RLock()
+			defer e.rwm.RUnlock()
+			return len(e.data) == 2
+		}, time.Second, time.Millisecond, index)
+		e.rwm.RLock()
+		assert.NotNil(t, e.data["c"])
+		assert.NotNil(t, e.data["d"])
+		e.rwm.RUnlock()
+
+		e.Invalidate("d")
+		assert.Equal(t, 1, e.Stats().TTLKeys)
+		assert.True(t, roughly(3600, e.GetTTL("c")[0]))
+		e.Close(context.Background())
+	}
+
+	opts := testOptionsDefault
+	opts.TTLIndex = TimingWheelTTL + 1
+	_, err := NewEngine(&opts)
+	assert.NotNil(t, err)
+}
+
+func TestLockFreeTTLReaders(t *testing.T) {
+
+	opts := testOptionsDefault
+	opts.TTLTickStep = 1 * time.Millisecond
+	opts.TTLIndex = LockFreeTTL
+	e, err := NewEngine(&opts)
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	exp := time.Now().Add(50 * time.Millisecond)
+	assert.Nil(t, e.Set("a", []byte("x"), &exp))
+	assert.Nil(t, e.Set("b", []byte("x"), &exp))
+	index := e.ttl.ttlIndex.(lockFreeTTL)
+
+	// popped while a reader holds the lock, deleted once it's released
+	e.rwm.RLock()
+	assert.Eventually(t, func() bool { return index.Len() == 0 },
+		time.Second, time.Millisecond)
+	assert.NotNil(t, e.data["a"])
+	e.rwm.RUnlock()
+
+	assert.Eventually(t, func() bool { return e.tryget("a") == nil },
+		time.Second, time.Millisecond)
+	assert.Equal(t, 0, e.Stats().TTLKeys)
+	assert.Equal(t, 0, e.Stats().Keys)
+}
+
+func BenchmarkSetExpiry(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		index TTLIndex
+	}{
+		{"skiplist", SkiplistTTL},
+		{"lockfree", LockFreeTTL},
+		{"timingwheel", TimingWheelTTL},
+	} {
+
+		b.Run(bc.name, func(b *testing.B) {
+			opts := testOptionsDefault
+			opts.TTLIndex = bc.index
+			e, _ := NewEngine(&opts)
+			defer e.Close(context.Background())
+
+			// millions of keys expiring within seconds to an hour
+			now := time.Now()
+			r := rand.New(rand.NewSource(1))
+			exps := make([]time.Time, 1<<16)
+			for i := range exps {
+				exps[i] = now.Add(time.Second + time.Duration(r.Int63n(int64(time.Hour))))
+			}
+			keys := make([]string, 2*1000*1000)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+			}
+
+			e.rwm.Lock()
+			defer e.rwm.Unlock()
+			for i, k := range keys {
+				e.setExpiry(k, exps[i&(len(exps)-1)])
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				e.setExpiry(keys[i%len(keys)], exps[(i*7919)&(len(exps)-1)])
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// Package httporigin implements an engine.Origin fetching values from an
+// upstream HTTP server.
+package httporigin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wv0m56/fury/engine"
+)
+
+// Origin fetches key by GETting it as a path below the upstream base URL,
+// e.g. "img/a.png" from http://upstream/static/img/a.png given a base URL of
+// http://upstream/static. The expiry of fetched values is derived from the
+// upstream's Cache-Control, Expires and Age response headers, the way a shared
+// cache would. ETag and Last-Modified are passed back to the engine as
+// validators, so that expired values are revalidated with a conditional
+// request instead of being downloaded again. The space separated keys of a
+// Surrogate-Key response header become the tags of the value, see
+// engine.Engine.InvalidateTag.
+// Origin implements both engine.Origin and engine.ContextOrigin.
+type Origin struct {
+	base   string
+	client *http.Client
+
+	// DefaultTTL applies to responses without Cache-Control max-age,
+	// s-maxage or Expires. Zero means such responses never expire.
+	DefaultTTL time.Duration
+}
+
+// New returns an Origin for the upstream at baseURL. A nil client means
+// http.DefaultClient.
+func New(baseURL string, client *http.Client) (*Origin, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported upstream scheme %q", u.Scheme)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Origin{base: strings.TrimSuffix(baseURL, "/"), client: client}, nil
+}
+
+func (o *Origin) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return engine.FromContextOrigin(o).Fetch(key, timeout)
+}
+
+func (o *Origin) FetchContext(ctx context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	req, err := http.NewRequest(http.MethodGet, o.url(key), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if v, ok := engine.ValidatorFromContext(ctx); ok {
+		etag, lastModified := splitValidator(v)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := o.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch resp.StatusCode {
+
+	case http.StatusOK:
+		return newBody(resp), o.expiry(resp.Header, time.Now()), nil
+
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, o.expiry(resp.Header, time.Now()), engine.ErrNotModified
+
+	case http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("upstream %s: %w", resp.Status, engine.ErrNotFound)
+
+	default:
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("upstream %s", resp.Status)
+	}
+}
+
+func (o *Origin) url(key string) string {
+	return o.base + "/" + (&url.URL{Path: strings.TrimPrefix(key, "/")}).EscapedPath()
+}
+
+// expiry maps the response headers onto the expiry returned by Fetch.
+// Responses which must not be stored by a shared cache expire at now, so that
+// they are served to the waiting callers only.
+func (o *Origin) expiry(h http.Header, now time.Time) *time.Time {
+
+	cc := directives(h)
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[name]; ok {
+			return &now
+		}
+	}
+
+	lifetime, ok := seconds(cc, "s-maxage")
+	if !ok {
+		lifetime, ok = seconds(cc, "max-age")
+	}
+	if !ok {
+		expires := h.Get("Expires")
+		if expires == "" {
+			if o.DefaultTTL > 0 {
+				t := now.Add(o.DefaultTTL)
+				return &t
+			}
+			return nil
+		}
+
+		t, err := http.ParseTime(expires)
+		if err != nil { // invalid dates mean already expired
+			return &now
+		}
+		if date, err := http.ParseTime(h.Get("Date")); err == nil {
+			lifetime = t.Sub(date)
+		} else {
+			lifetime = t.Sub(now)
+		}
+	}
+
+	// time already spent in upstream caches
+	if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime < 0 {
+		lifetime = 0
+	}
+
+	t := now.Add(lifetime)
+	return &t
+}
+
+// directives returns the Cache-Control directives of h by name.
+func directives(h http.Header) map[string]string {
+	m := make(map[string]string)
+	for _, line := range h["Cache-Control"] {
+		for _, directive := range strings.Split(line, ",") {
+			if name, value := splitDirective(directive); name != "" {
+				m[name] = value
+			}
+		}
+	}
+	return m
+}
+
+// seconds parses the delta-seconds value of the named directive.
+func seconds(cc map[string]string, name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// splitDirective splits a Cache-Control directive such as `max-age="60"` into
+// its lower cased name and unquoted value.
+func splitDirective(directive string) (name, value string) {
+	directive = strings.TrimSpace(directive)
+	if i := strings.IndexByte(directive, '='); i >= 0 {
+		name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+	} else {
+		name = directive
+	}
+	return strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+}
+
+// body is the io.ReadCloser returned by Fetch. It carries the response's
+// validators, surrogate keys and stale-while-revalidate and stale-if-error
+// directives back to the engine.
+type body struct {
+	io.ReadCloser
+	validator       string
+	tags            []string
+	whileRevalidate time.Duration
+	ifError         time.Duration
+}
+
+func newBody(resp *http.Response) io.ReadCloser {
+	b := &body{ReadCloser: resp.Body}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		b.validator = etag + "\n" + lastModified
+	}
+
+	for _, v := range resp.Header.Values("Surrogate-Key") {
+		b.tags = append(b.tags, strings.Fields(v)...)
+	}
+
+	cc := directives(resp.Header)
+	b.whileRevalidate, _ = seconds(cc, "stale-while-revalidate")
+	b.ifError, _ = seconds(cc, "stale-if-error")
+
+	if b.validator != "" {
+		return validatingBody{b}
+	}
+	return b
+}
+
+func (b *body) Stale() (whileRevalidate, ifError time.Duration) {
+	return b.whileRevalidate, b.ifError
+}
+
+func (b *body) Tags() []string {
+	return b.tags
+}
+
+// Validator is only implemented for responses with ETag or Last-Modified.
+type validatingBody struct {
+	*body
+}
+
+func (b validatingBody) Validator() string {
+	return b.validator
+}
+
+// splitValidator undoes the encoding of body.validator. Header values never
+// contain line breaks.
+func splitValidator(v string) (etag, lastModified string) {
+	if i := strings.IndexByte(v, '\n'); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
@@ -0,0 +1,165 @@
+package httporigin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/engine"
+)
+
+func TestExpiry(t *testing.T) {
+	o := &Origin{}
+	now := time.Now()
+
+	h := http.Header{}
+	assert.Nil(t, o.expiry(h, now))
+
+	o.DefaultTTL = time.Minute
+	assert.Equal(t, now.Add(time.Minute), *o.expiry(h, now))
+
+	h.Set("Expires", now.Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.Equal(t, now.Add(time.Hour).Unix(), o.expiry(h, now).Unix())
+
+	h.Set("Expires", "0")
+	assert.Equal(t, now, *o.expiry(h, now))
+
+	h.Set("Cache-Control", `public, MAX-AGE="60"`)
+	assert.Equal(t, now.Add(60*time.Second), *o.expiry(h, now))
+}
+
+func TestFetch(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/base/a/b c":
+				w.Header().Set("Cache-Control", "max-age=10")
+				w.Write([]byte("abc"))
+			case "/base/slow":
+				time.Sleep(50 * time.Millisecond)
+			case "/base/broken":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	defer upstream.Close()
+
+	_, err := New("ftp://upstream", nil)
+	assert.NotNil(t, err)
+
+	o, err := New(upstream.URL+"/base/", nil)
+	assert.Nil(t, err)
+
+	rc, exp, err := o.FetchContext(context.Background(), "a/b c")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "abc", string(b))
+	assert.True(t, exp.After(time.Now().Add(9*time.Second)))
+
+	_, _, err = o.FetchContext(context.Background(), "nope")
+	assert.True(t, errors.Is(err, engine.ErrNotFound))
+
+	_, _, err = o.Fetch("broken", time.Second)
+	assert.Equal(t, "upstream 500 Internal Server Error", err.Error())
+
+	_, _, err = o.Fetch("slow", 10*time.Millisecond)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestExpiryDirectives(t *testing.T) {
+	o := &Origin{DefaultTTL: time.Minute}
+	now := time.Now()
+
+	h := http.Header{}
+	h.Set("Cache-Control", "max-age=60, s-maxage=30")
+	assert.Equal(t, now.Add(30*time.Second), *o.expiry(h, now))
+
+	h.Set("Age", "10")
+	assert.Equal(t, now.Add(20*time.Second), *o.expiry(h, now))
+
+	h.Set("Age", "100")
+	assert.Equal(t, now, *o.expiry(h, now))
+
+	h = http.Header{}
+	h.Set("Date", now.Add(-time.Hour).UTC().Format(http.TimeFormat))
+	h.Set("Expires", now.UTC().Format(http.TimeFormat))
+	assert.Equal(t, now.Add(time.Hour).Unix(), o.expiry(h, now).Unix())
+
+	for _, cc := range []string{"no-store", "private", `no-cache="Set-Cookie"`} {
+		h = http.Header{}
+		h.Set("Cache-Control", "max-age=60, "+cc)
+		assert.Equal(t, now, *o.expiry(h, now))
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	var full, notModified int
+	maxAge := 60
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control",
+				fmt.Sprintf("max-age=%d, stale-if-error=30", maxAge))
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if r.Header.Get("If-None-Match") == `"v1"` &&
+				r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			full++
+			w.Write([]byte("abc"))
+		}))
+	defer upstream.Close()
+
+	o, err := New(upstream.URL, nil)
+	assert.Nil(t, err)
+
+	rc, _, err := o.FetchContext(context.Background(), "a")
+	assert.Nil(t, err)
+	rc.Close()
+
+	wr, ie := rc.(engine.Staler).Stale()
+	assert.Equal(t, time.Duration(0), wr)
+	assert.Equal(t, 30*time.Second, ie)
+
+	v, ok := rc.(engine.Validator)
+	assert.True(t, ok)
+	etag, lastModified := splitValidator(v.Validator())
+	assert.Equal(t, `"v1"`, etag)
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", lastModified)
+
+	// through the engine, which passes the validator back once expired
+	maxAge = 1
+	e, err := engine.NewEngine(&engine.Options{
+		ExpectedLen:                1024,
+		AccessStatsRelevanceWindow: time.Hour,
+		AccessStatsTickStep:        time.Second,
+		TTLTickStep:                time.Millisecond,
+		CacheFillTimeout:           time.Second,
+		O:                          o,
+		MaxPayloadTotalBytes:       10 * 1000 * 1000,
+	})
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	_, err = e.Get("a")
+	assert.Nil(t, err)
+	time.Sleep(1100 * time.Millisecond)
+
+	r, err := e.Get("a")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "abc", string(b))
+	assert.Equal(t, 2, full)
+	assert.Equal(t, 1, notModified)
+}
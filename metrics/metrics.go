@@ -0,0 +1,121 @@
+// Package metrics exposes the statistics of an engine.Engine (or
+// engine.ShardedEngine) in the Prometheus text exposition format, without
+// depending on the Prometheus client library.
+//
+//	http.Handle("/metrics", metrics.Handler(e))
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/wv0m56/fury/engine"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Source is implemented by engine.Engine and engine.ShardedEngine.
+type Source interface {
+	Stats() engine.Stats
+}
+
+// Handler returns an http.Handler serving the current statistics of e.
+func Handler(e Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if err := Write(w, e.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Write writes s to w in the text exposition format, with all metric names
+// prefixed by "fury_".
+func Write(w io.Writer, s engine.Stats) error {
+	mw := &writer{bufio.NewWriter(w)}
+
+	mw.counter("cache_hits_total", "Reads served a fresh value.", s.Hits)
+	mw.counter("cache_stale_hits_total", "Reads served a stale value.", s.StaleHits)
+	mw.counter("cache_misses_total", "Reads which started a cache fill.", s.Misses)
+	mw.counter("cache_coalesced_total", "Reads which joined a running cache fill.", s.Coalesced)
+	mw.counter("cache_negative_hits_total", "Reads answered with a cached origin error.", s.NegativeHits)
+
+	mw.counter("fills_total", "Cache fills started.", s.Fills)
+	mw.counter("fill_errors_total", "Cache fills failed.", s.FillErrors)
+	mw.counter("fills_rejected_total", "Fetched values not cached for their size or by admission.", s.Rejections)
+	mw.gauge("fills_in_flight", "Cache fills currently running.", int64(s.InFlightFills))
+	mw.histogram("fill_duration_seconds", "Duration of cache fills.", s.FillLatency)
+
+	mw.header("removals_total", "Rows removed from the cache, by reason.", "counter")
+	mw.removals(engine.EvictedRelevant, s.Evictions-s.IrrelevantEvictions)
+	mw.removals(engine.EvictedIrrelevant, s.IrrelevantEvictions)
+	mw.removals(engine.Expired, s.Expirations)
+	mw.removals(engine.Invalidated, s.Invalidations)
+
+	mw.counter("accesses_dropped_total", "Accesses not passed to the eviction policy under load.", s.DroppedAccesses)
+
+	mw.gauge("keys", "Cached rows, including stale ones.", int64(s.Keys))
+	mw.gauge("stale_keys", "Expired rows kept around.", int64(s.StaleKeys))
+	mw.gauge("ttl_keys", "Rows with an expiry.", int64(s.TTLKeys))
+	mw.gauge("negative_keys", "Cached origin errors.", int64(s.NegativeKeys))
+	mw.gauge("relevant_keys", "Rows accessed within the relevance window.", int64(s.RelevantKeys))
+	mw.gauge("irrelevant_keys", "Rows not accessed within the relevance window.", int64(s.IrrelevantKeys))
+
+	mw.gauge("payload_bytes", "Total size of cached values.", s.PayloadBytes)
+	mw.gauge("payload_max_bytes", "Maximum total size of cached values.", s.MaxPayloadBytes)
+
+	return mw.Flush()
+}
+
+// writer leaves error handling to Flush, bufio.Writer errors being sticky.
+type writer struct {
+	*bufio.Writer
+}
+
+func (mw *writer) header(name, help, typ string) {
+	fmt.Fprintf(mw, "# HELP fury_%s %s\n# TYPE fury_%s %s\n", name, help, name, typ)
+}
+
+func (mw *writer) sample(name, labels, value string) {
+	fmt.Fprintf(mw, "fury_%s%s %s\n", name, labels, value)
+}
+
+func (mw *writer) counter(name, help string, v uint64) {
+	mw.header(name, help, "counter")
+	mw.sample(name, "", strconv.FormatUint(v, 10))
+}
+
+func (mw *writer) gauge(name, help string, v int64) {
+	mw.header(name, help, "gauge")
+	mw.sample(name, "", strconv.FormatInt(v, 10))
+}
+
+// removals writes the removals_total sample of reason, labelled as events are.
+func (mw *writer) removals(reason engine.EventReason, v uint64) {
+	mw.sample("removals_total", `{reason="`+reason.String()+`"}`, strconv.FormatUint(v, 10))
+}
+
+// histogram writes h with cumulative buckets, in seconds.
+func (mw *writer) histogram(name, help string, h engine.Histogram) {
+	mw.header(name, help, "histogram")
+
+	var cumulative uint64
+	for i, count := range h.Counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = seconds(h.Bounds[i].Seconds())
+		}
+		mw.sample(name+"_bucket", `{le="`+le+`"}`, strconv.FormatUint(cumulative, 10))
+	}
+	mw.sample(name+"_sum", "", seconds(h.Sum.Seconds()))
+	mw.sample(name+"_count", "", strconv.FormatUint(h.Count, 10))
+}
+
+func seconds(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
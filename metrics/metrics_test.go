@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wv0m56/fury/engine"
+	"github.com/wv0m56/fury/testdummies"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, engine.Stats{
+		Hits:                3,
+		Evictions:           3,
+		IrrelevantEvictions: 1,
+		PayloadBytes:        42,
+		FillLatency: engine.Histogram{
+			Bounds: []time.Duration{time.Millisecond, time.Second},
+			Counts: []uint64{1, 2, 1},
+			Count:  4,
+			Sum:    2500 * time.Millisecond,
+		},
+	})
+	assert.Nil(t, err)
+
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE fury_cache_hits_total counter",
+		"fury_cache_hits_total 3",
+		`fury_removals_total{reason="evicted-relevant"} 2`,
+		`fury_removals_total{reason="evicted-irrelevant"} 1`,
+		"# TYPE fury_payload_bytes gauge",
+		"fury_payload_bytes 42",
+		"# TYPE fury_fill_duration_seconds histogram",
+		`fury_fill_duration_seconds_bucket{le="0.001"} 1`,
+		`fury_fill_duration_seconds_bucket{le="1"} 3`,
+		`fury_fill_duration_seconds_bucket{le="+Inf"} 4`,
+		"fury_fill_duration_seconds_sum 2.5",
+		"fury_fill_duration_seconds_count 4",
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+
+	// every sample is preceded by its HELP and TYPE
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			assert.True(t, strings.HasPrefix(line, "fury_"), line)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	e, err := engine.NewEngine(&engine.Options{
+		ExpectedLen:                1024,
+		AccessStatsRelevanceWindow: time.Hour,
+		AccessStatsTickStep:        time.Second,
+		TTLTickStep:                time.Second,
+		CacheFillTimeout:           time.Second,
+		O:                          &testdummies.NoDelayOrigin{},
+		MaxPayloadTotalBytes:       10 * 1000 * 1000,
+	})
+	assert.Nil(t, err)
+	defer e.Close(context.Background())
+
+	e.Get("a")
+	e.Get("a")
+
+	rec := httptest.NewRecorder()
+	Handler(e).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	b, _ := ioutil.ReadAll(rec.Body)
+	assert.Contains(t, string(b), "fury_cache_hits_total 1\n")
+	assert.Contains(t, string(b), "fury_cache_misses_total 1\n")
+	assert.Contains(t, string(b), "fury_keys 1\n")
+	assert.Contains(t, string(b), "fury_payload_max_bytes 10000000\n")
+}
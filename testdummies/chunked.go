@@ -0,0 +1,43 @@
+package testdummies
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ChunkedOrigin streams key 10 times over, one copy every Delay. Keys
+// prefixed by "fail" return an error after 5 copies.
+type ChunkedOrigin struct {
+	Delay time.Duration
+}
+
+func (co *ChunkedOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	return &chunkedReadCloser{key, co.Delay, 0}, nil, nil
+}
+
+type chunkedReadCloser struct {
+	key   string
+	delay time.Duration
+	sent  int
+}
+
+func (_ *chunkedReadCloser) Close() error {
+	return nil
+}
+
+func (crc *chunkedReadCloser) Read(p []byte) (int, error) {
+	if crc.sent == 10 {
+		return 0, io.EOF
+	}
+	if crc.sent == 5 && strings.HasPrefix(crc.key, "fail") {
+		return 0, errors.New("fake error midway")
+	}
+
+	time.Sleep(crc.delay)
+	crc.sent++
+	return copy(p, crc.key), nil
+}
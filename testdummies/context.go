@@ -0,0 +1,43 @@
+package testdummies
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+type valueKey struct{}
+
+// ValueKey is the context key under which ContextOrigin looks up payloads.
+var ValueKey = valueKey{}
+
+// ContextOrigin implements both Fetch and FetchContext. FetchContext returns
+// the string stored in ctx under ValueKey as payload. If there is none, it
+// blocks until ctx is done, sends key into Abandoned (if not nil) and returns
+// ctx.Err().
+type ContextOrigin struct {
+	Abandoned chan string
+}
+
+func (co *ContextOrigin) Fetch(key string, timeout time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return co.FetchContext(ctx, key)
+}
+
+func (co *ContextOrigin) FetchContext(ctx context.Context, key string) (
+	io.ReadCloser, *time.Time, error) {
+
+	if v, ok := ctx.Value(ValueKey).(string); ok {
+		return &nodelayReadCloser{bytes.NewReader([]byte(v)), key}, nil, nil
+	}
+
+	<-ctx.Done()
+	if co.Abandoned != nil {
+		co.Abandoned <- key
+	}
+	return nil, nil, ctx.Err()
+}
@@ -0,0 +1,59 @@
+package testdummies
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// FlakyOrigin returns key as payload, expiring after TTL. Fetch fails while
+// the origin is set to failing and counts how often it was called. If either
+// of WhileRevalidate or IfError is set, the returned io.ReadCloser implements
+// Stale() with those values.
+type FlakyOrigin struct {
+	TTL             time.Duration
+	WhileRevalidate time.Duration
+	IfError         time.Duration
+	failing         int32
+	fetches         int32
+}
+
+func (fo *FlakyOrigin) Fetch(key string, _ time.Duration) (
+	io.ReadCloser, *time.Time, error) {
+
+	atomic.AddInt32(&fo.fetches, 1)
+	if atomic.LoadInt32(&fo.failing) == 1 {
+		return nil, nil, errors.New("flaky origin failing")
+	}
+
+	t := time.Now().Add(fo.TTL)
+	rc := &nodelayReadCloser{bytes.NewReader([]byte(key)), key}
+	if fo.WhileRevalidate != 0 || fo.IfError != 0 {
+		return &staleReadCloser{rc, fo.WhileRevalidate, fo.IfError}, &t, nil
+	}
+	return rc, &t, nil
+}
+
+func (fo *FlakyOrigin) SetFailing(failing bool) {
+	if failing {
+		atomic.StoreInt32(&fo.failing, 1)
+	} else {
+		atomic.StoreInt32(&fo.failing, 0)
+	}
+}
+
+func (fo *FlakyOrigin) Fetches() int {
+	return int(atomic.LoadInt32(&fo.fetches))
+}
+
+type staleReadCloser struct {
+	*nodelayReadCloser
+	whileRevalidate time.Duration
+	ifError         time.Duration
+}
+
+func (src *staleReadCloser) Stale() (time.Duration, time.Duration) {
+	return src.whileRevalidate, src.ifError
+}